@@ -0,0 +1,163 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// ErrBasicChat is returned if the operation is not supported for basic chats
+// (i.e. it requires a supergroup or a channel).
+var ErrBasicChat = errors.New("operation is not supported for basic chats")
+
+// ErrChannel is returned if the operation is not supported for channels and
+// supergroups.
+var ErrChannel = errors.New("operation is not supported for channels and supergroups")
+
+// BanUser bans the user in the chat or channel dlg.  Basic chats have no ban
+// list, so the user is removed from the chat instead.
+func (c *Client) BanUser(ctx context.Context, dlg Entity, user tg.InputUserClass) error {
+	switch peer := dlg.(type) {
+	case *tg.Chat:
+		return c.deleteChatUser(ctx, peer, user)
+	case *tg.Channel:
+		return c.editBanned(ctx, peer, user, tg.ChatBannedRights{ViewMessages: true})
+	default:
+		return fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+}
+
+// UnbanUser removes the user from the ban list of the channel dlg.  It is a
+// no-op for basic chats.
+func (c *Client) UnbanUser(ctx context.Context, dlg Entity, user tg.InputUserClass) error {
+	switch peer := dlg.(type) {
+	case *tg.Chat:
+		return nil
+	case *tg.Channel:
+		return c.editBanned(ctx, peer, user, tg.ChatBannedRights{})
+	default:
+		return fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+}
+
+// KickUser removes the user from the chat or channel dlg, allowing them to
+// join again later.
+func (c *Client) KickUser(ctx context.Context, dlg Entity, user tg.InputUserClass) error {
+	switch peer := dlg.(type) {
+	case *tg.Chat:
+		return c.deleteChatUser(ctx, peer, user)
+	case *tg.Channel:
+		if err := c.editBanned(ctx, peer, user, tg.ChatBannedRights{ViewMessages: true}); err != nil {
+			return err
+		}
+		return c.editBanned(ctx, peer, user, tg.ChatBannedRights{})
+	default:
+		return fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+}
+
+// RestrictUser restricts the user in the supergroup dlg with the banned
+// rights.  If until is not zero, the restriction is lifted at that time,
+// otherwise it's permanent.  Basic chats do not support per-user restrictions,
+// and ErrBasicChat is returned.
+func (c *Client) RestrictUser(ctx context.Context, dlg Entity, user tg.InputUserClass, rights tg.ChatBannedRights, until time.Time) error {
+	switch peer := dlg.(type) {
+	case *tg.Chat:
+		return ErrBasicChat
+	case *tg.Channel:
+		return c.editBanned(ctx, peer, user, withUntil(rights, until))
+	default:
+		return fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+}
+
+// PromoteUser makes the user an administrator of the chat or channel dlg.
+// For basic chats, rights and title are ignored, as they only support the
+// admin flag.
+func (c *Client) PromoteUser(ctx context.Context, dlg Entity, user tg.InputUserClass, rights tg.ChatAdminRights, title string) error {
+	switch peer := dlg.(type) {
+	case *tg.Chat:
+		return c.editChatAdmin(ctx, peer, user, true)
+	case *tg.Channel:
+		return c.editAdmin(ctx, peer, user, rights, title)
+	default:
+		return fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+}
+
+// DemoteUser revokes the administrator rights of the user in the chat or
+// channel dlg.
+func (c *Client) DemoteUser(ctx context.Context, dlg Entity, user tg.InputUserClass) error {
+	switch peer := dlg.(type) {
+	case *tg.Chat:
+		return c.editChatAdmin(ctx, peer, user, false)
+	case *tg.Channel:
+		return c.editAdmin(ctx, peer, user, tg.ChatAdminRights{}, "")
+	default:
+		return fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+}
+
+func (c *Client) deleteChatUser(ctx context.Context, chat *tg.Chat, user tg.InputUserClass) error {
+	_, err := c.api().MessagesDeleteChatUser(ctx, &tg.MessagesDeleteChatUserRequest{
+		ChatID: chat.ID,
+		UserID: user,
+	})
+	return err
+}
+
+func (c *Client) editChatAdmin(ctx context.Context, chat *tg.Chat, user tg.InputUserClass, isAdmin bool) error {
+	_, err := c.api().MessagesEditChatAdmin(ctx, &tg.MessagesEditChatAdminRequest{
+		ChatID:  chat.ID,
+		UserID:  user,
+		IsAdmin: isAdmin,
+	})
+	return err
+}
+
+func (c *Client) editBanned(ctx context.Context, channel *tg.Channel, user tg.InputUserClass, rights tg.ChatBannedRights) error {
+	participant, err := userAsInputPeer(user)
+	if err != nil {
+		return err
+	}
+	_, err = c.api().ChannelsEditBanned(ctx, &tg.ChannelsEditBannedRequest{
+		Channel:      channel.AsInput(),
+		Participant:  participant,
+		BannedRights: rights,
+	})
+	return err
+}
+
+func (c *Client) editAdmin(ctx context.Context, channel *tg.Channel, user tg.InputUserClass, rights tg.ChatAdminRights, title string) error {
+	_, err := c.api().ChannelsEditAdmin(ctx, &tg.ChannelsEditAdminRequest{
+		Channel:     channel.AsInput(),
+		UserID:      user,
+		AdminRights: rights,
+		Rank:        title,
+	})
+	return err
+}
+
+// withUntil returns the copy of rights with the UntilDate set to until.  Zero
+// until means "forever".
+func withUntil(rights tg.ChatBannedRights, until time.Time) tg.ChatBannedRights {
+	rights.UntilDate = unixDate(until)
+	return rights
+}
+
+// userAsInputPeer converts the input user to the input peer.
+func userAsInputPeer(user tg.InputUserClass) (tg.InputPeerClass, error) {
+	switch u := user.(type) {
+	case *tg.InputUserSelf:
+		return &tg.InputPeerSelf{}, nil
+	case *tg.InputUser:
+		return &tg.InputPeerUser{UserID: u.UserID, AccessHash: u.AccessHash}, nil
+	case *tg.InputUserFromMessage:
+		return &tg.InputPeerUserFromMessage{Peer: u.Peer, MsgID: u.MsgID, UserID: u.UserID}, nil
+	default:
+		return nil, fmt.Errorf("unsupported input user type: %T", u)
+	}
+}
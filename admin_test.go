@@ -0,0 +1,75 @@
+package mtpwrap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_withUntil(t *testing.T) {
+	var until = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		rights tg.ChatBannedRights
+		until  time.Time
+		want   tg.ChatBannedRights
+	}{
+		{
+			"zero time means forever",
+			tg.ChatBannedRights{SendMessages: true, UntilDate: 42},
+			time.Time{},
+			tg.ChatBannedRights{SendMessages: true},
+		},
+		{
+			"sets the until date",
+			tg.ChatBannedRights{SendMedia: true},
+			until,
+			tg.ChatBannedRights{SendMedia: true, UntilDate: int(until.Unix())},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, withUntil(tt.rights, tt.until))
+		})
+	}
+}
+
+func Test_userAsInputPeer(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    tg.InputUserClass
+		want    tg.InputPeerClass
+		wantErr bool
+	}{
+		{
+			"self",
+			&tg.InputUserSelf{},
+			&tg.InputPeerSelf{},
+			false,
+		},
+		{
+			"user",
+			&tg.InputUser{UserID: 42, AccessHash: 100},
+			&tg.InputPeerUser{UserID: 42, AccessHash: 100},
+			false,
+		},
+		{
+			"empty",
+			&tg.InputUserEmpty{},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := userAsInputPeer(tt.user)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("userAsInputPeer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
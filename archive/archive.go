@@ -0,0 +1,461 @@
+// Package archive provides the local file-based message archive with
+// full-text search.
+//
+// The archive is an append-only log of JSON records in a single file.  On
+// open, the log is replayed into memory, and the full-text index is built.
+// Updated and deleted messages are appended as the new records, use Compact
+// to drop the stale ones.
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Filename is the name of the archive log file in the archive directory.
+const Filename = "messages.jsonl"
+
+// ErrClosed is returned if the archive is closed.
+var ErrClosed = errors.New("archive is closed")
+
+// PeerType is the type of the peer.  Chats, channels and users have separate
+// ID spaces, so the peer is identified by the type and ID.
+type PeerType string
+
+const (
+	PeerUser    PeerType = "user"
+	PeerChat    PeerType = "chat"
+	PeerChannel PeerType = "channel"
+)
+
+// Peer is the chat, channel or user, that the message belongs to.
+type Peer struct {
+	Type PeerType `json:"type"`
+	ID   int64    `json:"id"`
+}
+
+// Message is the archived message.
+type Message struct {
+	Peer     Peer       `json:"peer"`
+	ID       int        `json:"id"`
+	TopicID  int        `json:"topic_id,omitempty"` // forum topic ID, if any
+	FromID   int64      `json:"from_id,omitempty"`  // sender ID, if known
+	Date     time.Time  `json:"date"`
+	EditDate *time.Time `json:"edit_date,omitempty"` // nil, if not edited
+	Text     string     `json:"text,omitempty"`
+}
+
+type key struct {
+	peer Peer
+	id   int
+}
+
+func (m Message) key() key {
+	return key{m.Peer, m.ID}
+}
+
+// record is the log record.
+type record struct {
+	Message
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Archive is the message archive.  It is safe for concurrent use.
+type Archive struct {
+	mu   sync.RWMutex
+	path string
+	f    *os.File
+	w    *bufio.Writer
+
+	msgs  map[key]Message
+	terms map[string]map[key]struct{} // full-text index
+	last  map[Peer]int                // the latest message ID for each peer
+	stale int                         // number of superseded records in the log
+}
+
+// Open opens the archive in the directory dir, creating it, if it doesn't
+// exist.
+func Open(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, Filename)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{
+		path: path,
+		f:    f,
+		w:    bufio.NewWriter(f),
+	}
+	a.reset()
+	if err := a.load(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+	return a, nil
+}
+
+func (a *Archive) reset() {
+	a.msgs = make(map[key]Message)
+	a.terms = make(map[string]map[key]struct{})
+	a.last = make(map[Peer]int)
+	a.stale = 0
+}
+
+// load replays the log.  If the last record is truncated (i.e. the program
+// crashed while writing), it is discarded.
+func (a *Archive) load(f *os.File) error {
+	var (
+		r   = bufio.NewReader(f)
+		off int64
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				// incomplete record
+				if err := f.Truncate(off); err != nil {
+					return err
+				}
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("record at offset %d: %w", off, err)
+		}
+		a.apply(rec)
+		off += int64(len(line))
+	}
+	_, err := f.Seek(off, io.SeekStart)
+	return err
+}
+
+// apply applies the record to the in-memory state.
+func (a *Archive) apply(rec record) {
+	k := rec.key()
+	if old, ok := a.msgs[k]; ok {
+		a.unindex(old)
+		delete(a.msgs, k)
+		a.stale++
+	}
+	if rec.Deleted {
+		a.stale++
+		return
+	}
+	a.msgs[k] = rec.Message
+	a.index(rec.Message)
+	if rec.ID > a.last[rec.Peer] {
+		a.last[rec.Peer] = rec.ID
+	}
+}
+
+func (a *Archive) index(m Message) {
+	for _, t := range tokenize(m.Text) {
+		keys, ok := a.terms[t]
+		if !ok {
+			keys = make(map[key]struct{})
+			a.terms[t] = keys
+		}
+		keys[m.key()] = struct{}{}
+	}
+}
+
+func (a *Archive) unindex(m Message) {
+	for _, t := range tokenize(m.Text) {
+		delete(a.terms[t], m.key())
+		if len(a.terms[t]) == 0 {
+			delete(a.terms, t)
+		}
+	}
+}
+
+// Store adds the messages to the archive, replacing the existing ones with
+// the same peer and ID.  Messages that haven't changed are not written.
+func (a *Archive) Store(msgs ...Message) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return ErrClosed
+	}
+	for _, m := range msgs {
+		if old, ok := a.msgs[m.key()]; ok && old.equal(m) {
+			continue
+		}
+		if err := a.write(record{Message: m}); err != nil {
+			return err
+		}
+	}
+	return a.w.Flush()
+}
+
+// Delete removes the messages with ids of the peer from the archive.
+func (a *Archive) Delete(peer Peer, ids ...int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return ErrClosed
+	}
+	for _, id := range ids {
+		if _, ok := a.msgs[key{peer, id}]; !ok {
+			continue
+		}
+		if err := a.write(record{Message: Message{Peer: peer, ID: id}, Deleted: true}); err != nil {
+			return err
+		}
+	}
+	return a.w.Flush()
+}
+
+func (a *Archive) write(rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := a.w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	a.apply(rec)
+	return nil
+}
+
+func (m Message) equal(other Message) bool {
+	return m.Peer == other.Peer &&
+		m.ID == other.ID &&
+		m.TopicID == other.TopicID &&
+		m.FromID == other.FromID &&
+		m.Date.Equal(other.Date) &&
+		equalTime(m.EditDate, other.EditDate) &&
+		m.Text == other.Text
+}
+
+func equalTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// LastID returns the ID of the latest archived message of the peer, or 0 if
+// there are no messages.  It is used to fetch only the newer messages.
+func (a *Archive) LastID(peer Peer) int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.last[peer]
+}
+
+// Get returns the message with id of the peer.
+func (a *Archive) Get(peer Peer, id int) (Message, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	m, ok := a.msgs[key{peer, id}]
+	return m, ok
+}
+
+// Len returns the number of messages in the archive.
+func (a *Archive) Len() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.msgs)
+}
+
+// Query is the search query.  Zero fields are not used for filtering.
+type Query struct {
+	// Text is the full-text query, the message must contain all words of
+	// the query, the last word is matched as a prefix.
+	Text string
+	Peer Peer
+	// FromID is the sender ID.
+	FromID int64
+	// After and Before limit the message date, After is inclusive, Before
+	// is exclusive.
+	After  time.Time
+	Before time.Time
+	// Limit is the maximum number of messages returned.
+	Limit int
+}
+
+func (q Query) match(m Message) bool {
+	return (q.Peer == Peer{} || m.Peer == q.Peer) &&
+		(q.FromID == 0 || m.FromID == q.FromID) &&
+		(q.After.IsZero() || !m.Date.Before(q.After)) &&
+		(q.Before.IsZero() || m.Date.Before(q.Before))
+}
+
+// Search returns the messages that match the query, newest first.
+func (a *Archive) Search(q Query) ([]Message, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.f == nil {
+		return nil, ErrClosed
+	}
+
+	var found []Message
+	if words := tokenize(q.Text); len(words) > 0 {
+		for k := range a.textMatches(words) {
+			if m := a.msgs[k]; q.match(m) {
+				found = append(found, m)
+			}
+		}
+	} else {
+		for _, m := range a.msgs {
+			if q.match(m) {
+				found = append(found, m)
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].Date.Equal(found[j].Date) {
+			return found[i].Date.After(found[j].Date)
+		}
+		if pi, pj := found[i].Peer, found[j].Peer; pi != pj {
+			if pi.Type != pj.Type {
+				return pi.Type < pj.Type
+			}
+			return pi.ID < pj.ID
+		}
+		return found[i].ID > found[j].ID
+	})
+	if q.Limit > 0 && len(found) > q.Limit {
+		found = found[:q.Limit]
+	}
+	return found, nil
+}
+
+// textMatches returns the keys of messages, that contain all words, the last
+// word is matched as a prefix.
+func (a *Archive) textMatches(words []string) map[key]struct{} {
+	var result map[key]struct{}
+	for i, w := range words {
+		keys := make(map[key]struct{})
+		if i == len(words)-1 {
+			for t, tk := range a.terms {
+				if strings.HasPrefix(t, w) {
+					for k := range tk {
+						keys[k] = struct{}{}
+					}
+				}
+			}
+		} else {
+			for k := range a.terms[w] {
+				keys[k] = struct{}{}
+			}
+		}
+		if result == nil {
+			result = keys
+			continue
+		}
+		for k := range result {
+			if _, ok := keys[k]; !ok {
+				delete(result, k)
+			}
+		}
+	}
+	return result
+}
+
+// Compact rewrites the log, dropping the superseded and deleted records.
+func (a *Archive) Compact() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return ErrClosed
+	}
+	if a.stale == 0 {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), Filename+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, m := range a.msgs {
+		if err := enc.Encode(record{Message: m}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// the live file stays open and usable, until the compacted log replaces
+	// it.
+	if err := os.Rename(tmp.Name(), a.path); err != nil {
+		return err
+	}
+	old := a.f
+	f, err := os.OpenFile(a.path, os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		// the old file is replaced, writing to it would lose the records.
+		old.Close()
+		a.f = nil
+		return err
+	}
+	a.f = f
+	a.w = bufio.NewWriter(f)
+	a.stale = 0
+	// the records are in the compacted log, nothing is lost, if closing the
+	// replaced file fails.
+	_ = old.Close()
+	return nil
+}
+
+// Close flushes and closes the archive.
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.w.Flush()
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	a.f = nil
+	return err
+}
+
+// tokenize splits the text into lowercase words.
+func tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	// deduplicate, preserving order.
+	seen := make(map[string]struct{}, len(words))
+	out := words[:0]
+	for _, w := range words {
+		if _, ok := seen[w]; ok {
+			continue
+		}
+		seen[w] = struct{}{}
+		out = append(out, w)
+	}
+	return out
+}
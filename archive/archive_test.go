@@ -0,0 +1,233 @@
+package archive
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	p1  = Peer{PeerChat, 1}
+	p2  = Peer{PeerChannel, 2}
+	p3  = Peer{PeerUser, 3}
+	p42 = Peer{PeerUser, 42}
+)
+
+func testMessages() []Message {
+	return []Message{
+		{Peer: p1, ID: 1, FromID: 10, Date: base, Text: "Hello, world!"},
+		{Peer: p1, ID: 2, FromID: 11, Date: base.Add(time.Hour), Text: "hello there"},
+		{Peer: p1, ID: 3, FromID: 10, Date: base.Add(2 * time.Hour), Text: "Привет, мир"},
+		{Peer: p2, ID: 1, FromID: 10, Date: base.Add(3 * time.Hour), Text: "world peace"},
+	}
+}
+
+func openTest(t *testing.T, dir string) *Archive {
+	t.Helper()
+	a, err := Open(dir)
+	require.NoError(t, err)
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func ids(mm []Message) [][2]int64 {
+	var out [][2]int64
+	for _, m := range mm {
+		out = append(out, [2]int64{m.Peer.ID, int64(m.ID)})
+	}
+	return out
+}
+
+func TestArchive_Search(t *testing.T) {
+	a := openTest(t, t.TempDir())
+	require.NoError(t, a.Store(testMessages()...))
+
+	tests := []struct {
+		name string
+		q    Query
+		want [][2]int64
+	}{
+		{"all", Query{}, [][2]int64{{2, 1}, {1, 3}, {1, 2}, {1, 1}}},
+		{"word", Query{Text: "WORLD"}, [][2]int64{{2, 1}, {1, 1}}},
+		{"all words", Query{Text: "hello world"}, [][2]int64{{1, 1}}},
+		{"prefix", Query{Text: "hel"}, [][2]int64{{1, 2}, {1, 1}}},
+		{"non-prefix word must match exactly", Query{Text: "hel world"}, nil},
+		{"unicode", Query{Text: "мир"}, [][2]int64{{1, 3}}},
+		{"peer", Query{Peer: p1, Text: "world"}, [][2]int64{{1, 1}}},
+		{"sender", Query{FromID: 11}, [][2]int64{{1, 2}}},
+		{"date range", Query{After: base.Add(time.Hour), Before: base.Add(3 * time.Hour)}, [][2]int64{{1, 3}, {1, 2}}},
+		{"limit", Query{Limit: 1}, [][2]int64{{2, 1}}},
+		{"no match", Query{Text: "nothing"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Search(tt.q)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ids(got))
+		})
+	}
+}
+
+func TestArchive_PeerType(t *testing.T) {
+	a := openTest(t, t.TempDir())
+	user := Peer{PeerUser, 1}
+	require.NoError(t, a.Store(testMessages()...))
+	require.NoError(t, a.Store(
+		Message{Peer: user, ID: 1, Date: base, Text: "private"},
+		Message{Peer: user, ID: 5, Date: base, Text: "private"},
+	))
+
+	// the chat and the user with the same ID don't collide.
+	assert.Equal(t, len(testMessages())+2, a.Len())
+	got, ok := a.Get(p1, 1)
+	require.True(t, ok)
+	assert.Equal(t, "Hello, world!", got.Text)
+	assert.Equal(t, 3, a.LastID(p1))
+	assert.Equal(t, 5, a.LastID(user))
+
+	res, err := a.Search(Query{Peer: user})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int64{{1, 5}, {1, 1}}, ids(res))
+
+	require.NoError(t, a.Delete(user, 1))
+	_, ok = a.Get(p1, 1)
+	assert.True(t, ok, "chat message must not be deleted")
+	_, ok = a.Get(user, 1)
+	assert.False(t, ok)
+}
+
+func TestArchive_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, a.Store(testMessages()...))
+
+	// edit and delete.
+	editDate := base.Add(time.Minute)
+	edited := Message{Peer: p1, ID: 1, FromID: 10, Date: base, EditDate: &editDate, Text: "goodbye"}
+	require.NoError(t, a.Store(edited))
+	require.NoError(t, a.Delete(p1, 2))
+	require.NoError(t, a.Close())
+	assert.ErrorIs(t, a.Store(edited), ErrClosed)
+
+	a = openTest(t, dir)
+	assert.Equal(t, 3, a.Len())
+	got, ok := a.Get(p1, 1)
+	require.True(t, ok)
+	assert.True(t, edited.equal(got))
+	_, ok = a.Get(p1, 2)
+	assert.False(t, ok)
+	assert.Equal(t, 3, a.LastID(p1))
+	assert.Equal(t, 1, a.LastID(p2))
+	assert.Equal(t, 0, a.LastID(p42))
+
+	res, err := a.Search(Query{Text: "hello"})
+	require.NoError(t, err)
+	assert.Empty(t, res, "old text must be removed from the index")
+	res, err = a.Search(Query{Text: "goodbye"})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]int64{{1, 1}}, ids(res))
+}
+
+func TestArchive_Compact(t *testing.T) {
+	dir := t.TempDir()
+	a := openTest(t, dir)
+	require.NoError(t, a.Store(testMessages()...))
+	// storing the same messages again must not grow the log.
+	require.NoError(t, a.Store(testMessages()...))
+	require.NoError(t, a.Delete(p1, 1, 2, 3))
+
+	fi, err := os.Stat(filepath.Join(dir, Filename))
+	require.NoError(t, err)
+	before := fi.Size()
+
+	require.NoError(t, a.Compact())
+	fi, err = os.Stat(filepath.Join(dir, Filename))
+	require.NoError(t, err)
+	assert.Less(t, fi.Size(), before)
+
+	// archive remains writable after compaction.
+	require.NoError(t, a.Store(Message{Peer: p3, ID: 1, Date: base, Text: "after"}))
+	require.NoError(t, a.Close())
+
+	a = openTest(t, dir)
+	assert.Equal(t, 2, a.Len())
+	_, ok := a.Get(p3, 1)
+	assert.True(t, ok)
+}
+
+func TestArchive_CompactRenameError(t *testing.T) {
+	dir := t.TempDir()
+	a := openTest(t, dir)
+	require.NoError(t, a.Store(testMessages()...))
+	require.NoError(t, a.Delete(p1, 1))
+
+	// the directory in place of the log makes the rename fail.
+	path := filepath.Join(dir, Filename)
+	moved := filepath.Join(dir, "moved.jsonl")
+	require.NoError(t, os.Rename(path, moved))
+	require.NoError(t, os.MkdirAll(filepath.Join(path, "dir"), 0o700))
+
+	assert.Error(t, a.Compact())
+	// the live log is still open, and receives the records.
+	require.NoError(t, a.Store(Message{Peer: p3, ID: 1, Date: base, Text: "after"}))
+	require.NoError(t, a.Delete(p1, 2))
+	require.NoError(t, a.Close())
+	assert.ErrorIs(t, a.Store(Message{Peer: p3, ID: 2}), ErrClosed)
+
+	require.NoError(t, os.RemoveAll(path))
+	require.NoError(t, os.Rename(moved, path))
+	b := openTest(t, dir)
+	assert.Equal(t, len(testMessages())-1, b.Len())
+	_, ok := b.Get(p3, 1)
+	assert.True(t, ok)
+	_, ok = b.Get(p1, 2)
+	assert.False(t, ok)
+}
+
+func TestOpen_TruncatedRecord(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, a.Store(testMessages()[0]))
+	require.NoError(t, a.Close())
+
+	f, err := os.OpenFile(filepath.Join(dir, Filename), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"peer":{"type":"chat","id":1},"id":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	a = openTest(t, dir)
+	assert.Equal(t, 1, a.Len())
+	require.NoError(t, a.Store(testMessages()[1]))
+	require.NoError(t, a.Close())
+
+	a = openTest(t, dir)
+	assert.Equal(t, 2, a.Len())
+}
+
+func TestMessage_editDate(t *testing.T) {
+	data, err := json.Marshal(testMessages()[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "edit_date")
+
+	m := testMessages()[0]
+	editDate := base.Add(time.Minute)
+	m.EditDate = &editDate
+	assert.False(t, m.equal(testMessages()[0]))
+	other := base.Add(time.Minute)
+	assert.True(t, m.equal(Message{Peer: m.Peer, ID: m.ID, FromID: m.FromID, Date: m.Date, EditDate: &other, Text: m.Text}))
+}
+
+func Test_tokenize(t *testing.T) {
+	assert.Equal(t, []string{"hello", "world", "42"}, tokenize("Hello, WORLD! hello 42"))
+	assert.Empty(t, tokenize(" ,.! "))
+}
@@ -31,7 +31,7 @@ var (
 type noSignUp struct{}
 
 func (c noSignUp) SignUp(ctx context.Context) (auth.UserInfo, error) {
-	return auth.UserInfo{}, errors.New("not implemented")
+	return auth.UserInfo{}, errors.New("sign up is not enabled")
 }
 
 func (c noSignUp) AcceptTermsOfService(ctx context.Context, tos tg.HelpTermsOfService) error {
@@ -42,11 +42,46 @@ func (c noSignUp) AcceptTermsOfService(ctx context.Context, tos tg.HelpTermsOfSe
 type TermAuth struct {
 	noSignUp
 
-	phone string
+	phone  string
+	signUp bool
 }
 
-func NewTermAuth(phone string) TermAuth {
-	return TermAuth{phone: phone}
+// TermAuthOption is the TermAuth option.
+type TermAuthOption func(a *TermAuth)
+
+// WithSignUp allows to register the new account, if the phone number is not
+// registered.  The user is asked to accept the terms of service and to enter
+// the name.
+func WithSignUp(enable bool) TermAuthOption {
+	return func(a *TermAuth) {
+		a.signUp = enable
+	}
+}
+
+func NewTermAuth(phone string, opts ...TermAuthOption) TermAuth {
+	a := TermAuth{phone: phone}
+	for _, opt := range opts {
+		opt(&a)
+	}
+	return a
+}
+
+// AcceptTermsOfService displays the terms of service and asks for
+// acceptance, if the sign up is enabled, otherwise it returns
+// *auth.SignUpRequired.
+func (a TermAuth) AcceptTermsOfService(ctx context.Context, tos tg.HelpTermsOfService) error {
+	if !a.signUp {
+		return a.noSignUp.AcceptTermsOfService(ctx, tos)
+	}
+	return TermSignUp{}.AcceptTermsOfService(ctx, tos)
+}
+
+// SignUp asks for the name of the new account, if the sign up is enabled.
+func (a TermAuth) SignUp(ctx context.Context) (auth.UserInfo, error) {
+	if !a.signUp {
+		return a.noSignUp.SignUp(ctx)
+	}
+	return TermSignUp{}.SignUp(ctx)
 }
 
 var (
@@ -77,29 +112,60 @@ func (a TermAuth) Phone(_ context.Context) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		if phone == "" {
-			fmt.Fprintln(hOutput, phoneInvalid)
-			continue
-		}
-		if !strings.HasPrefix(phone, "+") || len(phone) < 2 {
-			fmt.Fprintln(hOutput, phoneMustIntl)
-			continue
-		}
-		if _, err := strconv.Atoi(phone[1:]); err != nil {
-			fmt.Fprintln(hOutput, phoneOnlyDigits)
+		if msg := checkPhone(phone); msg != "" {
+			fmt.Fprintln(hOutput, msg)
 			continue
 		}
 		return phone, nil
 	}
 }
 
+// checkPhone returns the error message, if the phone is not valid, or empty
+// string otherwise.
+func checkPhone(phone string) string {
+	switch {
+	case phone == "":
+		return phoneInvalid
+	case !strings.HasPrefix(phone, "+") || len(phone) < 2:
+		return phoneMustIntl
+	}
+	if _, err := strconv.Atoi(phone[1:]); err != nil {
+		return phoneOnlyDigits
+	}
+	return ""
+}
+
 func (a TermAuth) Password(ctx context.Context) (string, error) {
+	return a.PasswordWithHint(ctx, "")
+}
+
+// PasswordWithHint asks for the 2FA password, showing the hint, if it's not
+// empty.
+func (a TermAuth) PasswordWithHint(ctx context.Context, hint string) (string, error) {
 	defer fmt.Fprintln(hOutput)
 	fmt.Fprintln(hOutput, "Enter 2FA password (won't be shown)")
+	if hint != "" {
+		fmt.Fprintf(hOutput, "(i) Password hint: %s\n", hint)
+	}
 	fmt.Fprint(hOutput, "2FA> ")
 	return readpass(ctx, hInput)
 }
 
+// Retry reports the rejected code or password, and allows to enter it again.
+func (a TermAuth) Retry(_ context.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrCodeInvalid):
+		fmt.Fprintln(hOutput, codeInvalid)
+	case errors.Is(err, ErrCodeExpired):
+		fmt.Fprintln(hOutput, codeExpired)
+	case errors.Is(err, auth.ErrPasswordInvalid):
+		fmt.Fprintln(hOutput, passwordInvalid)
+	default:
+		fmt.Fprintf(hOutput, "*** %s ***\n", err)
+	}
+	return nil
+}
+
 func codeSpecifics(code *tg.AuthSentCode) (string, int) {
 	digits := func(where string, n int) string {
 		return fmt.Sprintf("The code %s.\nEnter exactly %d digits.", where, n)
@@ -130,6 +196,40 @@ func codeTimeout(code *tg.AuthSentCode) (string, time.Duration) {
 	return fmt.Sprintf("(enter code within %s)", ret), ret
 }
 
+// resendCmd is the input that requests the code to be resent.
+const resendCmd = "r"
+
+const (
+	codeInvalid     = "*** Invalid code, try again [Press Ctrl+C to abort] ***"
+	codeExpired     = "*** The code has expired, a new code has been requested ***"
+	passwordInvalid = "*** Invalid password, try again [Press Ctrl+C to abort] ***"
+)
+
+// codeNextType returns the description of the next delivery method of the
+// code, that is used if the code is resent.
+func codeNextType(code *tg.AuthSentCode) string {
+	next, ok := code.GetNextType()
+	if !ok {
+		return "again"
+	}
+	switch next.(type) {
+	case *tg.AuthCodeTypeSMS:
+		return "via SMS"
+	case *tg.AuthCodeTypeCall:
+		return "via phone call"
+	case *tg.AuthCodeTypeFlashCall:
+		return "via flash call"
+	case *tg.AuthCodeTypeMissedCall:
+		return "via missed call"
+	case *tg.AuthCodeTypeFragmentSMS:
+		return "via Fragment SMS"
+	default:
+		return "again"
+	}
+}
+
+// Code asks for the code.  Entering "r" requests the code to be resent, see
+// ErrResendCode.
 func (a TermAuth) Code(_ context.Context, code *tg.AuthSentCode) (string, error) {
 	codeHelp, length := codeSpecifics(code)
 	timeoutHelp, timeoutIn := codeTimeout(code)
@@ -141,17 +241,20 @@ func (a TermAuth) Code(_ context.Context, code *tg.AuthSentCode) (string, error)
 		if time.Now().After(timeout) {
 			return "", errors.New("operation timed out")
 		}
-		fmt.Printf("(i) TIP: %s\nCODE%s> ", codeHelp, timeoutHelp)
+		fmt.Fprintf(hOutput, "(i) TIP: %s\nEnter %q to resend the code %s.\nCODE%s> ", codeHelp, resendCmd, codeNextType(code), timeoutHelp)
 		input, err = readln(hInput)
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				return "", errors.New("login aborted")
 			}
 		}
+		if strings.EqualFold(input, resendCmd) {
+			return "", ErrResendCode
+		}
 		if len(input) == length || length == 0 {
 			break
 		}
-		fmt.Println("*** Invalid code, try again [Press Ctrl+C to abort] ***")
+		fmt.Fprintln(hOutput, codeInvalid)
 	}
 	return input, nil
 }
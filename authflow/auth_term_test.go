@@ -3,11 +3,14 @@ package authflow
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -208,3 +211,90 @@ func Test_readln(t *testing.T) {
 		})
 	}
 }
+
+func TestTermAuth_Code(t *testing.T) {
+	code := &tg.AuthSentCode{
+		Type:     &tg.AuthSentCodeTypeApp{Length: 5},
+		NextType: &tg.AuthCodeTypeSMS{},
+	}
+	code.SetFlags()
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"valid code", "12345", "12345", nil},
+		{"wrong length, then valid", "123\n12345", "12345", nil},
+		{"resend", "r", "", ErrResendCode},
+		{"resend, upper case", "R", "", ErrResendCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cap := StartCapture(t, strings.Split(tt.input, "\n")...)
+			got, err := TermAuth{}.Code(context.Background(), code)
+			output := cap.StopCapture()
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+			assert.Contains(t, output, `Enter "r" to resend the code via SMS.`)
+		})
+	}
+}
+
+func TestTermAuth_Retry(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantOut string
+	}{
+		{"invalid code", ErrCodeInvalid, codeInvalid + "\n"},
+		{"expired code", ErrCodeExpired, codeExpired + "\n"},
+		{"invalid password", auth.ErrPasswordInvalid, passwordInvalid + "\n"},
+		{"other", errors.New("resend code: FLOOD"), "*** resend code: FLOOD ***\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cap := StartCapture(t)
+			err := TermAuth{}.Retry(context.Background(), tt.err)
+			output := cap.StopCapture()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantOut, output)
+		})
+	}
+}
+
+func TestTermAuth_SignUp(t *testing.T) {
+	tos := tg.HelpTermsOfService{Text: "Be nice.", MinAgeConfirm: 16}
+	tos.SetFlags()
+
+	t.Run("not enabled", func(t *testing.T) {
+		a := NewTermAuth("")
+		assert.ErrorIs(t, a.AcceptTermsOfService(context.Background(), tos), &auth.SignUpRequired{})
+		_, err := a.SignUp(context.Background())
+		assert.Error(t, err)
+	})
+	t.Run("accepted", func(t *testing.T) {
+		a := NewTermAuth("", WithSignUp(true))
+		cap := StartCapture(t, "y", "", "John", "Doe")
+		err := a.AcceptTermsOfService(context.Background(), tos)
+		assert.NoError(t, err)
+		info, err := a.SignUp(context.Background())
+		output := cap.StopCapture()
+
+		assert.NoError(t, err)
+		assert.Equal(t, auth.UserInfo{FirstName: "John", LastName: "Doe"}, info)
+		assert.Contains(t, output, "Be nice.")
+		assert.Contains(t, output, "at least 16 years old")
+		assert.Contains(t, output, tosPrompt)
+		assert.Contains(t, output, nameRequired)
+	})
+	t.Run("declined", func(t *testing.T) {
+		a := NewTermAuth("", WithSignUp(true))
+		cap := StartCapture(t, "n")
+		err := a.AcceptTermsOfService(context.Background(), tos)
+		cap.StopCapture()
+		assert.ErrorIs(t, err, ErrTOSDeclined)
+	})
+}
@@ -0,0 +1,535 @@
+package authflow
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+)
+
+var (
+	// ErrTimeout is returned by WebAuth, if the form was not submitted in
+	// time.
+	ErrTimeout = errors.New("login form was not submitted in time")
+	// ErrWebAuthClosed is returned by WebAuth, if it was closed while
+	// waiting for the input.
+	ErrWebAuthClosed = errors.New("web login is closed")
+)
+
+const (
+	defWebAddr    = "127.0.0.1:0"
+	defWebTimeout = 5 * time.Minute
+)
+
+// WebAuth implements authentication via the login page, served on the
+// localhost.  The HTTP server is started on the first prompt, and the URL is
+// printed on the output.  Each form submission must carry the CSRF token,
+// and must arrive within the timeout, otherwise the prompt fails with
+// ErrTimeout.
+type WebAuth struct {
+	noSignUp
+
+	addr    string
+	phone   string
+	signUp  bool
+	timeout time.Duration
+
+	mu     sync.Mutex
+	srv    *http.Server
+	url    string
+	token  string
+	seq    int
+	step   *webStep
+	notice string // message to display on the next form
+	closed chan struct{}
+}
+
+// WebAuthOption is the WebAuth option.
+type WebAuthOption func(w *WebAuth)
+
+// WithWebTimeout sets the time to wait for each form submission.
+func WithWebTimeout(d time.Duration) WebAuthOption {
+	return func(w *WebAuth) {
+		if d > 0 {
+			w.timeout = d
+		}
+	}
+}
+
+// WithWebPhone sets the phone number, so that it's not asked.
+func WithWebPhone(phone string) WebAuthOption {
+	return func(w *WebAuth) {
+		w.phone = phone
+	}
+}
+
+// WithWebSignUp allows to register the new account, if the phone number is
+// not registered.  The user is asked to accept the terms of service and to
+// enter the name on the login page.
+func WithWebSignUp(enable bool) WebAuthOption {
+	return func(w *WebAuth) {
+		w.signUp = enable
+	}
+}
+
+// NewWebAuth returns the web authentication flow, that serves the login page
+// on addr, which must be the loopback address, i.e. "127.0.0.1:8080".  Empty
+// addr means a random port on 127.0.0.1.
+func NewWebAuth(addr string, opts ...WebAuthOption) (*WebAuth, error) {
+	if addr == "" {
+		addr = defWebAddr
+	}
+	if err := checkLoopback(addr); err != nil {
+		return nil, err
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	w := &WebAuth{
+		addr:    addr,
+		timeout: defWebTimeout,
+		token:   token,
+		closed:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w, nil
+}
+
+// checkLoopback returns an error, if addr is not the loopback address.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if !isLoopback(host) {
+		return fmt.Errorf("web login address must be the loopback address: %s", addr)
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func newToken() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// URL returns the URL of the login page, or empty string, if the server is
+// not started.
+func (w *WebAuth) URL() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.url
+}
+
+// Close stops the server.  Pending prompts fail with ErrWebAuthClosed.
+func (w *WebAuth) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.closed:
+		return nil
+	default:
+	}
+	close(w.closed)
+	if w.srv == nil {
+		return nil
+	}
+	return w.srv.Close()
+}
+
+// start starts the server, if it is not running.  It must be called with mu
+// held.
+func (w *WebAuth) start() error {
+	if w.srv != nil {
+		return nil
+	}
+	select {
+	case <-w.closed:
+		return ErrWebAuthClosed
+	default:
+	}
+	ln, err := net.Listen("tcp", w.addr)
+	if err != nil {
+		return err
+	}
+	w.srv = &http.Server{
+		Handler:           w,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	w.url = "http://" + ln.Addr().String() + "/"
+	go w.srv.Serve(ln)
+	fmt.Fprintf(hOutput, "Open %s in the browser to log in to Telegram.\n", w.url)
+	return nil
+}
+
+// webField is the input field of the form.
+type webField struct {
+	Name  string
+	Label string
+	Type  string // input type: text, password or number
+}
+
+// webStep is the form, awaiting the submission.
+type webStep struct {
+	ID      int
+	Title   string
+	Help    string
+	Notice  string
+	Text    string // long text, i.e. the terms of service
+	Fields  []webField
+	Submit  string // label of the submit button, "Submit" if empty
+	Resend  bool   // show the "resend code" button
+	Decline bool   // show the "decline" button
+	Token   string
+
+	answer chan url.Values
+}
+
+// ask shows the form and waits for its submission.
+func (w *WebAuth) ask(ctx context.Context, step webStep) (url.Values, error) {
+	w.mu.Lock()
+	if err := w.start(); err != nil {
+		w.mu.Unlock()
+		return nil, err
+	}
+	w.seq++
+	step.ID = w.seq
+	step.Token = w.token
+	step.Notice, w.notice = w.notice, ""
+	step.answer = make(chan url.Values, 1)
+	w.step = &step
+	w.mu.Unlock()
+
+	defer func() {
+		w.mu.Lock()
+		if w.step != nil && w.step.ID == step.ID {
+			w.step = nil
+		}
+		w.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	select {
+	case v := <-step.answer:
+		return v, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, ErrTimeout
+	case <-w.closed:
+		return nil, ErrWebAuthClosed
+	}
+}
+
+// setNotice sets the message, displayed on the next form.
+func (w *WebAuth) setNotice(msg string) {
+	w.mu.Lock()
+	w.notice = msg
+	w.mu.Unlock()
+}
+
+// ServeHTTP serves the current form on GET, and accepts its submission on
+// POST.
+func (w *WebAuth) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host // no port
+	}
+	if !isLoopback(host) {
+		// protects against DNS rebinding.
+		http.Error(rw, "invalid host", http.StatusForbidden)
+		return
+	}
+	if r.URL.Path != "/" {
+		http.NotFound(rw, r)
+		return
+	}
+	hdr := rw.Header()
+	hdr.Set("Cache-Control", "no-store")
+	hdr.Set("X-Frame-Options", "DENY")
+	hdr.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'")
+
+	switch r.Method {
+	case http.MethodGet:
+		w.mu.Lock()
+		step := w.step
+		w.mu.Unlock()
+		// the error is only possible, if the client has gone.
+		_ = webTmpl.Execute(rw, step)
+	case http.MethodPost:
+		w.submit(rw, r)
+	default:
+		rw.Header().Set("Allow", "GET, POST")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (w *WebAuth) submit(rw http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(rw, r.Body, 64<<10)
+	if err := r.ParseForm(); err != nil {
+		http.Error(rw, "invalid form", http.StatusBadRequest)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.PostForm.Get("csrf")), []byte(w.token)) != 1 {
+		http.Error(rw, "invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	id, _ := strconv.Atoi(r.PostForm.Get("step"))
+
+	w.mu.Lock()
+	step := w.step
+	if step != nil && step.ID == id {
+		step.answer <- r.PostForm
+		w.step = nil
+	}
+	w.mu.Unlock()
+
+	// the next form, if any, is shown on the page.
+	http.Redirect(rw, r, "/", http.StatusSeeOther)
+}
+
+func (w *WebAuth) GetAPICredentials(ctx context.Context) (int, string, error) {
+	step := webStep{
+		Title: "Telegram API credentials",
+		Help:  "Login to https://my.telegram.org/apps, create the application with the \"Desktop\" platform, and enter its App api_id and App api_hash.",
+		Fields: []webField{
+			{Name: "api_id", Label: "App api_id", Type: "number"},
+			{Name: "api_hash", Label: "App api_hash", Type: "password"},
+		},
+	}
+	for {
+		v, err := w.ask(ctx, step)
+		if err != nil {
+			return 0, "", err
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(v.Get("api_id")))
+		if err != nil {
+			w.setNotice("api_id should be an integer")
+			continue
+		}
+		hash := strings.TrimSpace(v.Get("api_hash"))
+		if hash == "" {
+			w.setNotice("api_hash is required")
+			continue
+		}
+		return id, hash, nil
+	}
+}
+
+func (w *WebAuth) Phone(ctx context.Context) (string, error) {
+	if w.phone != "" {
+		return w.phone, nil
+	}
+	step := webStep{
+		Title:  "Login to Telegram",
+		Help:   "Enter phone in international format, no spaces, for example +6422123456",
+		Fields: []webField{{Name: "phone", Label: "Phone", Type: "tel"}},
+	}
+	for {
+		v, err := w.ask(ctx, step)
+		if err != nil {
+			return "", err
+		}
+		phone := strings.TrimSpace(v.Get("phone"))
+		if msg := checkPhone(phone); msg != "" {
+			w.setNotice(msg)
+			continue
+		}
+		return phone, nil
+	}
+}
+
+// Code asks for the code.  Pressing the "Resend code" button requests the
+// code to be resent, see ErrResendCode.
+func (w *WebAuth) Code(ctx context.Context, code *tg.AuthSentCode) (string, error) {
+	help, _ := codeSpecifics(code)
+	step := webStep{
+		Title:  "Login code",
+		Help:   help,
+		Fields: []webField{{Name: "code", Label: "Code", Type: "text"}},
+		Resend: true,
+	}
+	for {
+		v, err := w.ask(ctx, step)
+		if err != nil {
+			return "", err
+		}
+		if v.Get("resend") != "" {
+			return "", ErrResendCode
+		}
+		input := strings.TrimSpace(v.Get("code"))
+		if input == "" {
+			w.setNotice("The code is required")
+			continue
+		}
+		return input, nil
+	}
+}
+
+func (w *WebAuth) Password(ctx context.Context) (string, error) {
+	return w.PasswordWithHint(ctx, "")
+}
+
+// PasswordWithHint asks for the 2FA password, showing the hint, if it's not
+// empty.
+func (w *WebAuth) PasswordWithHint(ctx context.Context, hint string) (string, error) {
+	step := webStep{
+		Title:  "Two-step verification",
+		Fields: []webField{{Name: "password", Label: "2FA password", Type: "password"}},
+	}
+	if hint != "" {
+		step.Help = "Password hint: " + hint
+	}
+	v, err := w.ask(ctx, step)
+	if err != nil {
+		return "", err
+	}
+	return v.Get("password"), nil
+}
+
+// AcceptTermsOfService displays the terms of service and asks for
+// acceptance, if the sign up is enabled.
+func (w *WebAuth) AcceptTermsOfService(ctx context.Context, tos tg.HelpTermsOfService) error {
+	if !w.signUp {
+		return w.noSignUp.AcceptTermsOfService(ctx, tos)
+	}
+	step := webStep{
+		Title:   "Terms of Service",
+		Text:    strings.TrimSpace(tos.Text),
+		Submit:  "Accept",
+		Decline: true,
+	}
+	if age, ok := tos.GetMinAgeConfirm(); ok && age > 0 {
+		step.Help = fmt.Sprintf("You must be at least %d years old to use Telegram.", age)
+	}
+	v, err := w.ask(ctx, step)
+	if err != nil {
+		return err
+	}
+	if v.Get("decline") != "" {
+		return ErrTOSDeclined
+	}
+	return nil
+}
+
+// SignUp asks for the first and last name of the new account, if the sign up
+// is enabled.
+func (w *WebAuth) SignUp(ctx context.Context) (auth.UserInfo, error) {
+	if !w.signUp {
+		return w.noSignUp.SignUp(ctx)
+	}
+	step := webStep{
+		Title: "Sign up",
+		Help:  "The phone number is not registered, enter the name for the new account.",
+		Fields: []webField{
+			{Name: "first_name", Label: "First name", Type: "text"},
+			{Name: "last_name", Label: "Last name (optional)", Type: "text"},
+		},
+	}
+	for {
+		v, err := w.ask(ctx, step)
+		if err != nil {
+			return auth.UserInfo{}, err
+		}
+		info := auth.UserInfo{
+			FirstName: strings.TrimSpace(v.Get("first_name")),
+			LastName:  strings.TrimSpace(v.Get("last_name")),
+		}
+		if info.FirstName == "" {
+			w.setNotice("First name is required")
+			continue
+		}
+		return info, nil
+	}
+}
+
+// Retry displays the rejected code or password error on the next form.
+func (w *WebAuth) Retry(_ context.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrCodeInvalid):
+		w.setNotice("Invalid code, try again")
+	case errors.Is(err, ErrCodeExpired):
+		w.setNotice("The code has expired, a new code has been requested")
+	case errors.Is(err, auth.ErrPasswordInvalid):
+		w.setNotice("Invalid password, try again")
+	default:
+		w.setNotice(err.Error())
+	}
+	return nil
+}
+
+var webTmpl = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Telegram login</title>
+{{- if not .}}
+<meta http-equiv="refresh" content="2">
+{{- end}}
+<style>
+body { font-family: sans-serif; max-width: 30em; margin: 3em auto; }
+label, input { display: block; width: 100%; margin-bottom: .5em; }
+.notice { color: #c00; }
+.text { white-space: pre-wrap; max-height: 20em; overflow-y: auto; border: 1px solid #ccc; padding: .5em; }
+</style>
+</head>
+<body>
+{{- if .}}
+<h1>{{.Title}}</h1>
+{{- if .Notice}}
+<p class="notice">{{.Notice}}</p>
+{{- end}}
+{{- if .Help}}
+<p>{{.Help}}</p>
+{{- end}}
+{{- if .Text}}
+<div class="text">{{.Text}}</div>
+{{- end}}
+<form method="post" action="/" autocomplete="off">
+<input type="hidden" name="csrf" value="{{.Token}}">
+<input type="hidden" name="step" value="{{.ID}}">
+{{- range .Fields}}
+<label for="{{.Name}}">{{.Label}}</label>
+<input id="{{.Name}}" name="{{.Name}}" type="{{.Type}}">
+{{- end}}
+<button type="submit">{{or .Submit "Submit"}}</button>
+{{- if .Resend}}
+<button type="submit" name="resend" value="1">Resend code</button>
+{{- end}}
+{{- if .Decline}}
+<button type="submit" name="decline" value="1">Decline</button>
+{{- end}}
+</form>
+{{- else}}
+<p>Please wait&hellip;</p>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,252 @@
+package authflow
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	reToken = regexp.MustCompile(`name="csrf" value="([0-9a-f]+)"`)
+	reStep  = regexp.MustCompile(`name="step" value="(\d+)"`)
+)
+
+// newTestWebAuth returns the WebAuth, that discards its output.
+func newTestWebAuth(t *testing.T, opts ...WebAuthOption) *WebAuth {
+	t.Helper()
+	cap := StartCapture(t)
+	t.Cleanup(func() { cap.StopCapture() })
+	w, err := NewWebAuth("", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+// waitForm waits until the form is shown, and returns the page, the CSRF
+// token and the step ID.
+func waitForm(t *testing.T, w *WebAuth) (page, token, step string) {
+	t.Helper()
+	require.Eventually(t, func() bool { return w.URL() != "" }, time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(w.URL())
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		page = string(b)
+		return reStep.MatchString(page)
+	}, time.Second, 5*time.Millisecond)
+	return page, reToken.FindStringSubmatch(page)[1], reStep.FindStringSubmatch(page)[1]
+}
+
+// submitForm submits the form values and returns the response status code.
+func submitForm(t *testing.T, w *WebAuth, v url.Values) int {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.PostForm(w.URL(), v)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+type phoneResult struct {
+	phone string
+	err   error
+}
+
+func askPhone(w *WebAuth) <-chan phoneResult {
+	ch := make(chan phoneResult, 1)
+	go func() {
+		phone, err := w.Phone(context.Background())
+		ch <- phoneResult{phone, err}
+	}()
+	return ch
+}
+
+func TestNewWebAuth(t *testing.T) {
+	for _, addr := range []string{"", "127.0.0.1:0", "localhost:8080", "[::1]:0"} {
+		_, err := NewWebAuth(addr)
+		assert.NoError(t, err, addr)
+	}
+	for _, addr := range []string{"0.0.0.0:8080", ":8080", "example.com:80", "127.0.0.1"} {
+		_, err := NewWebAuth(addr)
+		assert.Error(t, err, addr)
+	}
+}
+
+func TestWebAuth_Phone(t *testing.T) {
+	w := newTestWebAuth(t)
+	res := askPhone(w)
+
+	_, token, step := waitForm(t, w)
+	code := submitForm(t, w, url.Values{"csrf": {token}, "step": {step}, "phone": {"123"}})
+	assert.Equal(t, http.StatusSeeOther, code)
+
+	// invalid phone, the form is shown again with the notice.
+	page, token, step := waitForm(t, w)
+	assert.Contains(t, page, "international format")
+	assert.Contains(t, page, `class="notice"`)
+	submitForm(t, w, url.Values{"csrf": {token}, "step": {step}, "phone": {"+64221234567"}})
+
+	r := <-res
+	assert.NoError(t, r.err)
+	assert.Equal(t, "+64221234567", r.phone)
+}
+
+func TestWebAuth_CSRF(t *testing.T) {
+	w := newTestWebAuth(t)
+	res := askPhone(w)
+
+	_, token, step := waitForm(t, w)
+	code := submitForm(t, w, url.Values{"csrf": {"bad"}, "step": {step}, "phone": {"+64221234567"}})
+	assert.Equal(t, http.StatusForbidden, code)
+	code = submitForm(t, w, url.Values{"step": {step}, "phone": {"+64221234567"}})
+	assert.Equal(t, http.StatusForbidden, code)
+
+	// the prompt is still waiting.
+	submitForm(t, w, url.Values{"csrf": {token}, "step": {step}, "phone": {"+64221234567"}})
+	r := <-res
+	assert.NoError(t, r.err)
+}
+
+func TestWebAuth_Host(t *testing.T) {
+	w := newTestWebAuth(t)
+	res := askPhone(w)
+	waitForm(t, w)
+
+	req, err := http.NewRequest(http.MethodGet, w.URL(), nil)
+	require.NoError(t, err)
+	req.Host = "attacker.example.com"
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	w.Close()
+	assert.ErrorIs(t, (<-res).err, ErrWebAuthClosed)
+}
+
+func TestWebAuth_Timeout(t *testing.T) {
+	w := newTestWebAuth(t, WithWebTimeout(50*time.Millisecond))
+	_, err := w.Phone(context.Background())
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	// the stale form is not accepted.
+	page, err := http.Get(w.URL())
+	require.NoError(t, err)
+	b, _ := io.ReadAll(page.Body)
+	page.Body.Close()
+	assert.NotContains(t, string(b), `name="step"`)
+}
+
+func TestWebAuth_Code(t *testing.T) {
+	w := newTestWebAuth(t)
+	sent := &tg.AuthSentCode{Type: &tg.AuthSentCodeTypeApp{Length: 5}}
+
+	type result struct {
+		code string
+		err  error
+	}
+	ask := func() <-chan result {
+		ch := make(chan result, 1)
+		go func() {
+			code, err := w.Code(context.Background(), sent)
+			ch <- result{code, err}
+		}()
+		return ch
+	}
+
+	res := ask()
+	page, token, step := waitForm(t, w)
+	assert.Contains(t, page, "Resend code")
+	submitForm(t, w, url.Values{"csrf": {token}, "step": {step}, "resend": {"1"}})
+	assert.ErrorIs(t, (<-res).err, ErrResendCode)
+
+	res = ask()
+	_, token, step = waitForm(t, w)
+	submitForm(t, w, url.Values{"csrf": {token}, "step": {step}, "code": {" 12345 "}})
+	r := <-res
+	assert.NoError(t, r.err)
+	assert.Equal(t, "12345", r.code)
+}
+
+func TestWebAuth_PasswordWithHint(t *testing.T) {
+	w := newTestWebAuth(t)
+	w.Retry(context.Background(), ErrCodeInvalid)
+
+	res := make(chan string, 1)
+	go func() {
+		pwd, _ := w.PasswordWithHint(context.Background(), "pet <name>")
+		res <- pwd
+	}()
+	page, token, step := waitForm(t, w)
+	assert.Contains(t, page, "Password hint: pet &lt;name&gt;")
+	assert.Contains(t, page, "Invalid code, try again")
+	submitForm(t, w, url.Values{"csrf": {token}, "step": {step}, "password": {" secret "}})
+	assert.Equal(t, " secret ", <-res)
+}
+
+func TestWebAuth_SignUp(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		w := newTestWebAuth(t)
+		var sr *auth.SignUpRequired
+		assert.ErrorAs(t, w.AcceptTermsOfService(context.Background(), tg.HelpTermsOfService{}), &sr)
+		_, err := w.SignUp(context.Background())
+		assert.Error(t, err)
+	})
+	t.Run("accept", func(t *testing.T) {
+		w := newTestWebAuth(t, WithWebSignUp(true))
+		tos := tg.HelpTermsOfService{Text: "Be <nice>"}
+		tos.SetMinAgeConfirm(16)
+
+		res := make(chan error, 1)
+		go func() { res <- w.AcceptTermsOfService(context.Background(), tos) }()
+		page, token, step := waitForm(t, w)
+		assert.Contains(t, page, "Be &lt;nice&gt;")
+		assert.Contains(t, page, "at least 16 years old")
+		assert.Contains(t, page, ">Accept</button>")
+		submitForm(t, w, url.Values{"csrf": {token}, "step": {step}})
+		assert.NoError(t, <-res)
+	})
+	t.Run("decline", func(t *testing.T) {
+		w := newTestWebAuth(t, WithWebSignUp(true))
+		res := make(chan error, 1)
+		go func() { res <- w.AcceptTermsOfService(context.Background(), tg.HelpTermsOfService{Text: "tos"}) }()
+		_, token, step := waitForm(t, w)
+		submitForm(t, w, url.Values{"csrf": {token}, "step": {step}, "decline": {"1"}})
+		assert.ErrorIs(t, <-res, ErrTOSDeclined)
+	})
+	t.Run("name", func(t *testing.T) {
+		w := newTestWebAuth(t, WithWebSignUp(true))
+		type result struct {
+			info auth.UserInfo
+			err  error
+		}
+		res := make(chan result, 1)
+		go func() {
+			info, err := w.SignUp(context.Background())
+			res <- result{info, err}
+		}()
+		_, token, step := waitForm(t, w)
+		submitForm(t, w, url.Values{"csrf": {token}, "step": {step}, "first_name": {" "}, "last_name": {"Doe"}})
+
+		page, token, step := waitForm(t, w)
+		assert.Contains(t, page, "First name is required")
+		submitForm(t, w, url.Values{"csrf": {token}, "step": {step}, "first_name": {" John "}})
+		r := <-res
+		assert.NoError(t, r.err)
+		assert.Equal(t, auth.UserInfo{FirstName: "John"}, r.info)
+	})
+}
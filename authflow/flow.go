@@ -0,0 +1,259 @@
+package authflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+var (
+	// ErrResendCode is returned by the Code method of the authenticator to
+	// request the code to be sent again.  Telegram may send it with a
+	// different delivery method (i.e. SMS or phone call), see the NextType
+	// of the sent code.
+	ErrResendCode = errors.New("resend code requested")
+	// ErrCodeInvalid is passed to Retrier, if the code was rejected.
+	ErrCodeInvalid = errors.New("invalid code")
+	// ErrCodeExpired is passed to Retrier, if the code has expired.  The new
+	// code is requested automatically.
+	ErrCodeExpired = errors.New("code expired")
+)
+
+// maxAttempts is the maximum number of attempts to enter the code or the
+// password.
+const maxAttempts = 5
+
+// Retrier is implemented by authenticators that can handle the rejected code
+// or password without restarting the whole flow.
+type Retrier interface {
+	// Retry is called when the input was rejected or the code could not be
+	// resent.  If it returns nil, the user is asked again, otherwise the flow
+	// is aborted with the returned error.
+	Retry(ctx context.Context, err error) error
+}
+
+// PasswordHinter is implemented by authenticators that can show the 2FA
+// password hint.  If implemented, it is used instead of Password.
+type PasswordHinter interface {
+	PasswordWithHint(ctx context.Context, hint string) (string, error)
+}
+
+// API is the subset of the Telegram API used by the flow.
+type API interface {
+	AuthResendCode(ctx context.Context, request *tg.AuthResendCodeRequest) (tg.AuthSentCodeClass, error)
+	AccountGetPassword(ctx context.Context) (*tg.AccountPassword, error)
+	HelpAcceptTermsOfService(ctx context.Context, id tg.DataJSON) (bool, error)
+}
+
+// IfNecessary runs the flow, if the session is not authorized.
+func IfNecessary(ctx context.Context, cl *auth.Client, api API, flow auth.Flow) error {
+	st, err := cl.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("get auth status: %w", err)
+	}
+	if st.Authorized {
+		return nil
+	}
+	if err := Run(ctx, cl, api, flow); err != nil {
+		return fmt.Errorf("auth flow: %w", err)
+	}
+	return nil
+}
+
+// Run runs the authentication flow.  Unlike auth.Flow.Run, it resends the
+// code, if the authenticator returns ErrResendCode, and, if the authenticator
+// implements Retrier, asks for the code or password again when it's rejected.
+// Authenticators that don't implement the optional interfaces behave the same
+// as with auth.Flow.
+func Run(ctx context.Context, cl auth.FlowClient, api API, flow auth.Flow) error {
+	if flow.Auth == nil {
+		return errors.New("no UserAuthenticator provided")
+	}
+	a := flow.Auth
+	phone, err := a.Phone(ctx)
+	if err != nil {
+		return fmt.Errorf("get phone: %w", err)
+	}
+	sent, err := sendCode(ctx, cl, phone, flow.Options)
+	if err != nil || sent == nil {
+		return signUpIfRequired(ctx, cl, api, a, phone, err)
+	}
+
+	for attempt := 1; ; {
+		code, err := a.Code(ctx, sent)
+		if errors.Is(err, ErrResendCode) {
+			sent, err = resendCode(ctx, api, phone, sent)
+			if err != nil {
+				if err := retry(ctx, a, err, err); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("get code: %w", err)
+		}
+
+		_, err = cl.SignIn(ctx, phone, code, sent.PhoneCodeHash)
+		var signUpRequired *auth.SignUpRequired
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, auth.ErrPasswordAuthNeeded):
+			return password(ctx, cl, api, a)
+		case errors.As(err, &signUpRequired):
+			return signUp(ctx, cl, api, a, phone, sent.PhoneCodeHash, signUpRequired)
+		case tgerr.Is(err, "PHONE_CODE_INVALID", "PHONE_CODE_EMPTY") && attempt < maxAttempts:
+			if err := retry(ctx, a, ErrCodeInvalid, err); err != nil {
+				return fmt.Errorf("sign in: %w", err)
+			}
+			attempt++
+		case tgerr.Is(err, "PHONE_CODE_EXPIRED") && attempt < maxAttempts:
+			if err := retry(ctx, a, ErrCodeExpired, err); err != nil {
+				return fmt.Errorf("sign in: %w", err)
+			}
+			attempt++
+			sent, err = sendCode(ctx, cl, phone, flow.Options)
+			if err != nil || sent == nil {
+				return signUpIfRequired(ctx, cl, api, a, phone, err)
+			}
+		default:
+			return fmt.Errorf("sign in: %w", err)
+		}
+	}
+}
+
+// retry asks the authenticator, if the input should be retried after the
+// reason.  Authenticators that don't implement Retrier abort with the original
+// error orig.
+func retry(ctx context.Context, a auth.UserAuthenticator, reason, orig error) error {
+	r, ok := a.(Retrier)
+	if !ok {
+		return orig
+	}
+	return r.Retry(ctx, reason)
+}
+
+// signUpIfRequired handles the error returned by sendCode: if the sign up is
+// required, it registers the new account, otherwise it returns err.
+func signUpIfRequired(ctx context.Context, cl auth.FlowClient, api API, a auth.UserAuthenticator, phone string, err error) error {
+	var signUpRequired *auth.SignUpRequired
+	if errors.As(err, &signUpRequired) {
+		return signUp(ctx, cl, api, a, phone, "", signUpRequired)
+	}
+	return err
+}
+
+// sendCode sends the code to the phone.  It returns nil, if the session is
+// already authorized, or *auth.SignUpRequired, if the account must be
+// registered.
+func sendCode(ctx context.Context, cl auth.FlowClient, phone string, opts auth.SendCodeOptions) (*tg.AuthSentCode, error) {
+	sent, err := cl.SendCode(ctx, phone, opts)
+	if err != nil {
+		return nil, fmt.Errorf("send code: %w", err)
+	}
+	switch s := sent.(type) {
+	case *tg.AuthSentCode:
+		return s, nil
+	case *tg.AuthSentCodeSuccess:
+		switch a := s.Authorization.(type) {
+		case *tg.AuthAuthorization:
+			return nil, nil
+		case *tg.AuthAuthorizationSignUpRequired:
+			return nil, &auth.SignUpRequired{TermsOfService: a.TermsOfService}
+		default:
+			return nil, fmt.Errorf("unexpected authorization type: %T", a)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected sent code type: %T", sent)
+	}
+}
+
+// resendCode requests the code to be sent again, using the next delivery
+// method.  On error, the previously sent code is returned, so that the user
+// can still enter it.
+func resendCode(ctx context.Context, api API, phone string, prev *tg.AuthSentCode) (*tg.AuthSentCode, error) {
+	resp, err := api.AuthResendCode(ctx, &tg.AuthResendCodeRequest{
+		PhoneNumber:   phone,
+		PhoneCodeHash: prev.PhoneCodeHash,
+	})
+	if err != nil {
+		return prev, fmt.Errorf("resend code: %w", err)
+	}
+	sent, ok := resp.(*tg.AuthSentCode)
+	if !ok {
+		return prev, fmt.Errorf("unexpected sent code type: %T", resp)
+	}
+	return sent, nil
+}
+
+// password asks for the 2FA password, showing the hint, if the authenticator
+// supports it.
+func password(ctx context.Context, cl auth.FlowClient, api API, a auth.UserAuthenticator) error {
+	var hint string
+	hinter, ok := a.(PasswordHinter)
+	if ok {
+		p, err := api.AccountGetPassword(ctx)
+		if err != nil {
+			return fmt.Errorf("get password hint: %w", err)
+		}
+		hint = p.Hint
+	}
+	for attempt := 1; ; attempt++ {
+		var (
+			pwd string
+			err error
+		)
+		if hinter != nil {
+			pwd, err = hinter.PasswordWithHint(ctx, hint)
+		} else {
+			pwd, err = a.Password(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("get password: %w", err)
+		}
+		_, err = cl.Password(ctx, pwd)
+		if errors.Is(err, auth.ErrPasswordInvalid) && attempt < maxAttempts {
+			if err := retry(ctx, a, err, err); err != nil {
+				return fmt.Errorf("sign in with password: %w", err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("sign in with password: %w", err)
+		}
+		return nil
+	}
+}
+
+// signUp registers the new account, if the authenticator accepts the terms of
+// service and provides the name.  The accepted terms of service are reported
+// to the server.
+func signUp(ctx context.Context, cl auth.FlowClient, api API, a auth.UserAuthenticator, phone, hash string, s *auth.SignUpRequired) error {
+	tos := s.TermsOfService
+	if err := a.AcceptTermsOfService(ctx, tos); err != nil {
+		return fmt.Errorf("confirm TOS: %w", err)
+	}
+	info, err := a.SignUp(ctx)
+	if err != nil {
+		return fmt.Errorf("sign up info not provided: %w", err)
+	}
+	if _, err := cl.SignUp(ctx, auth.SignUp{
+		PhoneNumber:   phone,
+		PhoneCodeHash: hash,
+		FirstName:     info.FirstName,
+		LastName:      info.LastName,
+	}); err != nil {
+		return fmt.Errorf("sign up: %w", err)
+	}
+	if tos.ID.Data != "" {
+		if _, err := api.HelpAcceptTermsOfService(ctx, tos.ID); err != nil {
+			return fmt.Errorf("accept TOS: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package authflow
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient records the calls and returns the canned responses.
+type fakeClient struct {
+	sent      []tg.AuthSentCodeClass // responses to SendCode, in order
+	resent    tg.AuthSentCodeClass
+	signIn    []error // errors returned by SignIn, in order
+	password  []error // errors returned by Password, in order
+	hint      string
+	codes     []string // codes passed to SignIn
+	hashes    []string // hashes passed to SignIn
+	passwords []string
+	resends   int
+	signUps   []auth.SignUp
+	accepted  []tg.DataJSON
+}
+
+func (f *fakeClient) SendCode(ctx context.Context, phone string, options auth.SendCodeOptions) (tg.AuthSentCodeClass, error) {
+	s := f.sent[0]
+	if len(f.sent) > 1 {
+		f.sent = f.sent[1:]
+	}
+	return s, nil
+}
+
+func (f *fakeClient) SignIn(ctx context.Context, phone, code, codeHash string) (*tg.AuthAuthorization, error) {
+	f.codes = append(f.codes, code)
+	f.hashes = append(f.hashes, codeHash)
+	var err error
+	if len(f.signIn) > 0 {
+		err, f.signIn = f.signIn[0], f.signIn[1:]
+	}
+	return &tg.AuthAuthorization{}, err
+}
+
+func (f *fakeClient) Password(ctx context.Context, password string) (*tg.AuthAuthorization, error) {
+	f.passwords = append(f.passwords, password)
+	var err error
+	if len(f.password) > 0 {
+		err, f.password = f.password[0], f.password[1:]
+	}
+	return &tg.AuthAuthorization{}, err
+}
+
+func (f *fakeClient) SignUp(ctx context.Context, s auth.SignUp) (*tg.AuthAuthorization, error) {
+	f.signUps = append(f.signUps, s)
+	return &tg.AuthAuthorization{}, nil
+}
+
+func (f *fakeClient) HelpAcceptTermsOfService(ctx context.Context, id tg.DataJSON) (bool, error) {
+	f.accepted = append(f.accepted, id)
+	return true, nil
+}
+
+func (f *fakeClient) AuthResendCode(ctx context.Context, request *tg.AuthResendCodeRequest) (tg.AuthSentCodeClass, error) {
+	f.resends++
+	if f.resent == nil {
+		return nil, tgerr.New(400, "SEND_CODE_UNAVAILABLE")
+	}
+	return f.resent, nil
+}
+
+func (f *fakeClient) AccountGetPassword(ctx context.Context) (*tg.AccountPassword, error) {
+	return &tg.AccountPassword{Hint: f.hint}, nil
+}
+
+// fakeAuth returns the codes and passwords in order, and records the retries
+// and hints.
+type fakeAuth struct {
+	noSignUp
+	codes     []string // "" means ErrResendCode
+	passwords []string
+	retries   []error
+	hints     []string
+}
+
+func (a *fakeAuth) Phone(ctx context.Context) (string, error) { return "+6422123456", nil }
+
+func (a *fakeAuth) Code(ctx context.Context, sentCode *tg.AuthSentCode) (string, error) {
+	if len(a.codes) == 0 {
+		return "", errors.New("no more codes")
+	}
+	code := a.codes[0]
+	a.codes = a.codes[1:]
+	if code == "" {
+		return "", ErrResendCode
+	}
+	return code, nil
+}
+
+func (a *fakeAuth) Password(ctx context.Context) (string, error) {
+	if len(a.passwords) == 0 {
+		return "", errors.New("no more passwords")
+	}
+	pwd := a.passwords[0]
+	a.passwords = a.passwords[1:]
+	return pwd, nil
+}
+
+// retryingAuth implements Retrier and PasswordHinter.
+type retryingAuth struct {
+	fakeAuth
+}
+
+func (a *retryingAuth) Retry(ctx context.Context, err error) error {
+	a.retries = append(a.retries, err)
+	return nil
+}
+
+func (a *retryingAuth) PasswordWithHint(ctx context.Context, hint string) (string, error) {
+	a.hints = append(a.hints, hint)
+	return a.Password(ctx)
+}
+
+func sentCode(hash string) *tg.AuthSentCode {
+	return &tg.AuthSentCode{
+		Type:          &tg.AuthSentCodeTypeApp{Length: 5},
+		PhoneCodeHash: hash,
+	}
+}
+
+var errCodeInvalid = tgerr.New(400, "PHONE_CODE_INVALID")
+
+func TestRun(t *testing.T) {
+	t.Run("resend code", func(t *testing.T) {
+		cl := &fakeClient{
+			sent:   []tg.AuthSentCodeClass{sentCode("h1")},
+			resent: sentCode("h2"),
+		}
+		a := &fakeAuth{codes: []string{"", "12345"}}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, cl.resends)
+		assert.Equal(t, []string{"h2"}, cl.hashes)
+	})
+	t.Run("resend failed, retrier enters the old code", func(t *testing.T) {
+		cl := &fakeClient{sent: []tg.AuthSentCodeClass{sentCode("h1")}}
+		a := &retryingAuth{fakeAuth{codes: []string{"", "12345"}}}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"h1"}, cl.hashes)
+		if assert.Len(t, a.retries, 1) {
+			assert.True(t, tgerr.Is(a.retries[0], "SEND_CODE_UNAVAILABLE"))
+		}
+	})
+	t.Run("invalid code without retrier aborts", func(t *testing.T) {
+		cl := &fakeClient{
+			sent:   []tg.AuthSentCodeClass{sentCode("h1")},
+			signIn: []error{errCodeInvalid},
+		}
+		a := &fakeAuth{codes: []string{"11111", "12345"}}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.True(t, tgerr.Is(err, "PHONE_CODE_INVALID"))
+		assert.Equal(t, []string{"11111"}, cl.codes)
+	})
+	t.Run("invalid code is retried", func(t *testing.T) {
+		cl := &fakeClient{
+			sent:   []tg.AuthSentCodeClass{sentCode("h1")},
+			signIn: []error{errCodeInvalid},
+		}
+		a := &retryingAuth{fakeAuth{codes: []string{"11111", "12345"}}}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"11111", "12345"}, cl.codes)
+		assert.Equal(t, []error{ErrCodeInvalid}, a.retries)
+	})
+	t.Run("too many invalid codes", func(t *testing.T) {
+		cl := &fakeClient{sent: []tg.AuthSentCodeClass{sentCode("h1")}}
+		for i := 0; i < maxAttempts; i++ {
+			cl.signIn = append(cl.signIn, errCodeInvalid)
+		}
+		a := &retryingAuth{fakeAuth{codes: []string{"1", "2", "3", "4", "5", "6"}}}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.True(t, tgerr.Is(err, "PHONE_CODE_INVALID"))
+		assert.Len(t, cl.codes, maxAttempts)
+	})
+	t.Run("expired code requests the new one", func(t *testing.T) {
+		cl := &fakeClient{
+			sent:   []tg.AuthSentCodeClass{sentCode("h1"), sentCode("h2")},
+			signIn: []error{tgerr.New(400, "PHONE_CODE_EXPIRED")},
+		}
+		a := &retryingAuth{fakeAuth{codes: []string{"11111", "12345"}}}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"h1", "h2"}, cl.hashes)
+		assert.Equal(t, []error{ErrCodeExpired}, a.retries)
+	})
+	t.Run("password with hint and retry", func(t *testing.T) {
+		cl := &fakeClient{
+			sent:     []tg.AuthSentCodeClass{sentCode("h1")},
+			signIn:   []error{auth.ErrPasswordAuthNeeded},
+			password: []error{auth.ErrPasswordInvalid},
+			hint:     "pet name",
+		}
+		a := &retryingAuth{fakeAuth{codes: []string{"12345"}, passwords: []string{"wrong", "right"}}}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"wrong", "right"}, cl.passwords)
+		assert.Equal(t, []string{"pet name", "pet name"}, a.hints)
+		assert.Equal(t, []error{auth.ErrPasswordInvalid}, a.retries)
+	})
+	t.Run("password without hinter", func(t *testing.T) {
+		cl := &fakeClient{
+			sent:     []tg.AuthSentCodeClass{sentCode("h1")},
+			signIn:   []error{auth.ErrPasswordAuthNeeded},
+			password: []error{auth.ErrPasswordInvalid},
+		}
+		a := &fakeAuth{codes: []string{"12345"}, passwords: []string{"wrong", "right"}}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.ErrorIs(t, err, auth.ErrPasswordInvalid)
+		assert.Equal(t, []string{"wrong"}, cl.passwords)
+	})
+	t.Run("already authorized", func(t *testing.T) {
+		cl := &fakeClient{
+			sent: []tg.AuthSentCodeClass{&tg.AuthSentCodeSuccess{Authorization: &tg.AuthAuthorization{}}},
+		}
+		a := &fakeAuth{}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.NoError(t, err)
+		assert.Empty(t, cl.codes)
+	})
+	t.Run("sign up required, not enabled", func(t *testing.T) {
+		cl := &fakeClient{
+			sent:   []tg.AuthSentCodeClass{sentCode("h1")},
+			signIn: []error{&auth.SignUpRequired{}},
+		}
+		a := &fakeAuth{codes: []string{"12345"}}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.ErrorIs(t, err, &auth.SignUpRequired{})
+		assert.Empty(t, cl.signUps)
+	})
+	t.Run("sign up", func(t *testing.T) {
+		tos := tg.HelpTermsOfService{ID: tg.DataJSON{Data: `"tos-1"`}, Text: "be nice"}
+		cl := &fakeClient{
+			sent:   []tg.AuthSentCodeClass{sentCode("h1")},
+			signIn: []error{&auth.SignUpRequired{TermsOfService: tos}},
+		}
+		a := &signUpAuth{fakeAuth: fakeAuth{codes: []string{"12345"}}}
+		err := Run(context.Background(), cl, cl, auth.NewFlow(a, auth.SendCodeOptions{}))
+		assert.NoError(t, err)
+		assert.Equal(t, []auth.SignUp{{PhoneNumber: "+6422123456", PhoneCodeHash: "h1", FirstName: "John", LastName: "Doe"}}, cl.signUps)
+		assert.Equal(t, []tg.DataJSON{tos.ID}, cl.accepted)
+		assert.Equal(t, "be nice", a.tos.Text)
+	})
+}
+
+// signUpAuth accepts the terms of service and signs up as John Doe.
+type signUpAuth struct {
+	fakeAuth
+	tos tg.HelpTermsOfService
+}
+
+func (a *signUpAuth) AcceptTermsOfService(ctx context.Context, tos tg.HelpTermsOfService) error {
+	a.tos = tos
+	return nil
+}
+
+func (a *signUpAuth) SignUp(ctx context.Context) (auth.UserInfo, error) {
+	return auth.UserInfo{FirstName: "John", LastName: "Doe"}, nil
+}
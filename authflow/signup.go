@@ -0,0 +1,71 @@
+package authflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+)
+
+// ErrTOSDeclined is returned, if the user declines the terms of service.
+var ErrTOSDeclined = errors.New("terms of service declined")
+
+// TermSignUp implements the sign up of the new account via terminal.  It can
+// be embedded into other authenticators to allow registering new phone
+// numbers.
+type TermSignUp struct{}
+
+const (
+	tosPrompt     = "Do you accept the terms of service? [y/N]> "
+	nameRequired  = "*** First name is required ***"
+	signUpWelcome = "The phone number is not registered, enter the name for the new account."
+)
+
+// AcceptTermsOfService displays the terms of service and asks for acceptance.
+func (TermSignUp) AcceptTermsOfService(_ context.Context, tos tg.HelpTermsOfService) error {
+	fmt.Fprintln(hOutput, line)
+	fmt.Fprintln(hOutput, "Terms of Service:")
+	fmt.Fprintln(hOutput)
+	fmt.Fprintln(hOutput, strings.TrimSpace(tos.Text))
+	if age, ok := tos.GetMinAgeConfirm(); ok && age > 0 {
+		fmt.Fprintf(hOutput, "\nYou must be at least %d years old to use Telegram.\n", age)
+	}
+	fmt.Fprintln(hOutput, line)
+	fmt.Fprint(hOutput, tosPrompt)
+	answer, err := readln(hInput)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return nil
+	default:
+		return ErrTOSDeclined
+	}
+}
+
+// SignUp asks for the first and last name of the new account.
+func (TermSignUp) SignUp(_ context.Context) (auth.UserInfo, error) {
+	fmt.Fprintln(hOutput, signUpWelcome)
+	var info auth.UserInfo
+	for info.FirstName == "" {
+		fmt.Fprint(hOutput, "FIRST NAME> ")
+		name, err := readln(hInput)
+		if err != nil {
+			return auth.UserInfo{}, err
+		}
+		if info.FirstName = name; name == "" {
+			fmt.Fprintln(hOutput, nameRequired)
+		}
+	}
+	fmt.Fprint(hOutput, "LAST NAME (optional)> ")
+	name, err := readln(hInput)
+	if err != nil {
+		return auth.UserInfo{}, err
+	}
+	info.LastName = name
+	return info, nil
+}
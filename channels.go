@@ -0,0 +1,179 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+)
+
+// CreateSupergroup creates a supergroup (megagroup) and returns it.
+func (c *Client) CreateSupergroup(ctx context.Context, title string, about string) (Entity, error) {
+	return c.createChannel(ctx, &tg.ChannelsCreateChannelRequest{
+		Megagroup: true,
+		Title:     title,
+		About:     about,
+	})
+}
+
+// CreateChannel creates a broadcast channel and returns it.
+func (c *Client) CreateChannel(ctx context.Context, title string, about string) (Entity, error) {
+	return c.createChannel(ctx, &tg.ChannelsCreateChannelRequest{
+		Broadcast: true,
+		Title:     title,
+		About:     about,
+	})
+}
+
+// CreateForum creates a supergroup with topics enabled and returns it.
+func (c *Client) CreateForum(ctx context.Context, title string, about string) (Entity, error) {
+	return c.createChannel(ctx, &tg.ChannelsCreateChannelRequest{
+		Megagroup: true,
+		Forum:     true,
+		Title:     title,
+		About:     about,
+	})
+}
+
+func (c *Client) createChannel(ctx context.Context, req *tg.ChannelsCreateChannelRequest) (Entity, error) {
+	if req.Title == "" {
+		return nil, errors.New("title is required")
+	}
+	resp, err := c.api().ChannelsCreateChannel(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.entityFromUpdates(ctx, resp)
+}
+
+// MigrateChat converts the basic chat to a supergroup, and returns the new
+// supergroup.  The old chat is deactivated by telegram.
+func (c *Client) MigrateChat(ctx context.Context, dlg Entity) (Entity, error) {
+	chat, ok := dlg.(*tg.Chat)
+	if !ok {
+		return nil, fmt.Errorf("only basic chats can be migrated, got: %T", dlg)
+	}
+	resp, err := c.api().MessagesMigrateChat(ctx, chat.ID)
+	if err != nil {
+		return nil, err
+	}
+	return c.entityFromUpdates(ctx, resp)
+}
+
+// EditTitle changes the title of the chat or channel dlg.
+func (c *Client) EditTitle(ctx context.Context, dlg Entity, title string) error {
+	var err error
+	switch peer := dlg.(type) {
+	case *tg.Chat:
+		_, err = c.api().MessagesEditChatTitle(ctx, &tg.MessagesEditChatTitleRequest{
+			ChatID: peer.ID,
+			Title:  title,
+		})
+	case *tg.Channel:
+		_, err = c.api().ChannelsEditTitle(ctx, &tg.ChannelsEditTitleRequest{
+			Channel: peer.AsInput(),
+			Title:   title,
+		})
+	default:
+		return fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+	return err
+}
+
+// EditAbout changes the description of the chat or channel dlg.
+func (c *Client) EditAbout(ctx context.Context, dlg Entity, about string) error {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return err
+	}
+	_, err = c.api().MessagesEditChatAbout(ctx, &tg.MessagesEditChatAboutRequest{
+		Peer:  ip,
+		About: about,
+	})
+	return err
+}
+
+// EditPhoto uploads the image file from path and sets it as the photo of the
+// chat or channel dlg.
+func (c *Client) EditPhoto(ctx context.Context, dlg Entity, path string) error {
+	f, err := uploader.NewUploader(c.api()).FromPath(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to upload: %w", err)
+	}
+	photo := &tg.InputChatUploadedPhoto{File: f}
+
+	switch peer := dlg.(type) {
+	case *tg.Chat:
+		_, err = c.api().MessagesEditChatPhoto(ctx, &tg.MessagesEditChatPhotoRequest{
+			ChatID: peer.ID,
+			Photo:  photo,
+		})
+	case *tg.Channel:
+		_, err = c.api().ChannelsEditPhoto(ctx, &tg.ChannelsEditPhotoRequest{
+			Channel: peer.AsInput(),
+			Photo:   photo,
+		})
+	default:
+		return fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+	return err
+}
+
+// SetSlowMode sets the slow mode interval for the supergroup dlg.  Zero
+// interval disables the slow mode.  Telegram accepts only the specific values
+// (10s, 30s, 1m, 5m, 15m and 1h).
+func (c *Client) SetSlowMode(ctx context.Context, dlg Entity, interval time.Duration) error {
+	channel, err := asInputChannel(dlg)
+	if err != nil {
+		return err
+	}
+	_, err = c.api().ChannelsToggleSlowMode(ctx, &tg.ChannelsToggleSlowModeRequest{
+		Channel: channel,
+		Seconds: int(interval / time.Second),
+	})
+	return err
+}
+
+// SetDefaultRights sets the default banned rights for all members of the chat
+// or supergroup dlg.
+func (c *Client) SetDefaultRights(ctx context.Context, dlg Entity, rights tg.ChatBannedRights) error {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return err
+	}
+	_, err = c.api().MessagesEditChatDefaultBannedRights(ctx, &tg.MessagesEditChatDefaultBannedRightsRequest{
+		Peer:         ip,
+		BannedRights: rights,
+	})
+	return err
+}
+
+// SetUsername sets the public username of the channel dlg.  Empty username
+// makes the channel private.
+func (c *Client) SetUsername(ctx context.Context, dlg Entity, username string) error {
+	channel, err := asInputChannel(dlg)
+	if err != nil {
+		return err
+	}
+	_, err = c.api().ChannelsUpdateUsername(ctx, &tg.ChannelsUpdateUsernameRequest{
+		Channel:  channel,
+		Username: username,
+	})
+	return err
+}
+
+// asInputChannel returns the input channel for the entity.  Basic chats are
+// not channels, and ErrBasicChat is returned for them.
+func asInputChannel(ent Entity) (tg.InputChannelClass, error) {
+	switch peer := ent.(type) {
+	case *tg.Channel:
+		return peer.AsInput(), nil
+	case *tg.Chat:
+		return nil, ErrBasicChat
+	default:
+		return nil, fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+}
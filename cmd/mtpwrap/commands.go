@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+
+	"github.com/rusq/mtpwrap"
+)
+
+func runLogin(ctx context.Context, cl *mtpwrap.Client, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	self, err := cl.Client().Self(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("logged in as %s (id: %d)\n", mtpwrap.UserEntity{User: self}.GetTitle(), self.ID)
+	return nil
+}
+
+func runList(ctx context.Context, cl *mtpwrap.Client, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	kind := fs.String("type", "all", "entity `type`: chats, channels, users or all")
+	q := fs.String("q", "", "list only entities, which title contains the `substring`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var filter mtpwrap.FilterFunc
+	switch *kind {
+	case "chats":
+		filter = mtpwrap.FilterChat()
+	case "channels":
+		filter = mtpwrap.FilterChannel()
+	case "users":
+		filter = mtpwrap.FilterUser()
+	case "all":
+		filter = filterAny(mtpwrap.FilterChat(), mtpwrap.FilterChannel(), mtpwrap.FilterUser())
+	default:
+		return fmt.Errorf("unknown type: %q", *kind)
+	}
+
+	ents, err := cl.GetEntities(ctx, filter)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "ID\tTYPE\tTITLE")
+	for _, ent := range ents {
+		if !containsFold(ent.GetTitle(), *q) {
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", ent.GetID(), entityType(ent), ent.GetTitle())
+	}
+	return nil
+}
+
+func runSearch(ctx context.Context, cl *mtpwrap.Client, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	id := fs.Int64("peer", 0, "chat or channel `ID`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ent, err := findEntity(ctx, cl, *id)
+	if err != nil {
+		return err
+	}
+	msgs, err := cl.SearchAllMyMessages(ctx, ent, nil)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "ID\tDATE\tTEXT")
+	for _, m := range msgs {
+		rec := newRecord(m)
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", rec.ID, rec.Date.Format(time.DateTime), oneLine(rec.Text, 60))
+	}
+	fmt.Fprintf(tw, "\ntotal: %d\n", len(msgs))
+	return nil
+}
+
+func runDelete(ctx context.Context, cl *mtpwrap.Client, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	id := fs.Int64("peer", 0, "chat or channel `ID`")
+	yes := fs.Bool("y", false, "do not ask for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ent, err := findEntity(ctx, cl, *id)
+	if err != nil {
+		return err
+	}
+	msgs, err := cl.SearchAllMyMessages(ctx, ent, nil)
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		fmt.Println("no messages to delete")
+		return nil
+	}
+	if !*yes {
+		ok, err := confirm(os.Stdin, os.Stdout, fmt.Sprintf("Delete %d messages from %q?", len(msgs), ent.GetTitle()))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("cancelled")
+			return nil
+		}
+	}
+	n, err := cl.DeleteMessages(ctx, ent, msgs)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("deleted %d messages\n", n)
+	return nil
+}
+
+func runExport(ctx context.Context, cl *mtpwrap.Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	id := fs.Int64("peer", 0, "chat or channel `ID`")
+	output := fs.String("o", "-", "output `file`, \"-\" for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ent, err := findEntity(ctx, cl, *id)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	msgs, err := cl.GetHistory(ctx, ent, nil)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, m := range msgs {
+		if err := enc.Encode(newRecord(m)); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d messages\n", len(msgs))
+	return nil
+}
+
+// record is the exported message.
+type record struct {
+	ID     int       `json:"id"`
+	Date   time.Time `json:"date"`
+	FromID int64     `json:"from_id,omitempty"`
+	Text   string    `json:"text,omitempty"`
+}
+
+func newRecord(m messages.Elem) record {
+	rec := record{ID: m.Msg.GetID()}
+	msg, ok := m.Msg.(*tg.Message)
+	if !ok {
+		return rec
+	}
+	rec.Date = time.Unix(int64(msg.Date), 0)
+	rec.Text = msg.Message
+	if from, ok := msg.GetFromID(); ok {
+		switch p := from.(type) {
+		case *tg.PeerUser:
+			rec.FromID = p.UserID
+		case *tg.PeerChat:
+			rec.FromID = p.ChatID
+		case *tg.PeerChannel:
+			rec.FromID = p.ChannelID
+		}
+	}
+	return rec
+}
+
+func findEntity(ctx context.Context, cl *mtpwrap.Client, id int64) (mtpwrap.Entity, error) {
+	if id == 0 {
+		return nil, errors.New("peer ID is required")
+	}
+	ents, err := cl.GetEntities(ctx, mtpwrap.FilterPeer(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(ents) == 0 {
+		return nil, fmt.Errorf("chat or channel %d not found", id)
+	}
+	return ents[0], nil
+}
+
+// filterAny returns the entity for the first filter that matches.
+func filterAny(filters ...mtpwrap.FilterFunc) mtpwrap.FilterFunc {
+	return func(p storage.Peer) (mtpwrap.Entity, bool) {
+		for _, fn := range filters {
+			if ent, ok := fn(p); ok {
+				return ent, true
+			}
+		}
+		return nil, false
+	}
+}
+
+func entityType(ent mtpwrap.Entity) string {
+	switch e := ent.(type) {
+	case *tg.Chat:
+		return "chat"
+	case *tg.Channel:
+		if e.Broadcast {
+			return "channel"
+		}
+		return "supergroup"
+	case mtpwrap.UserEntity:
+		if e.Bot {
+			return "bot"
+		}
+		return "user"
+	default:
+		return "unknown"
+	}
+}
+
+func runSessions(ctx context.Context, cl *mtpwrap.Client, args []string) error {
+	fs := flag.NewFlagSet("sessions", flag.ContinueOnError)
+	terminate := fs.Int64("terminate", 0, "terminate the session with the `hash`")
+	others := fs.Bool("terminate-others", false, "terminate all sessions, except the current one")
+	yes := fs.Bool("y", false, "do not ask for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *terminate != 0 || *others {
+		prompt := fmt.Sprintf("Terminate the session %d?", *terminate)
+		if *others {
+			prompt = "Terminate all other sessions?"
+		}
+		if !*yes {
+			ok, err := confirm(os.Stdin, os.Stdout, prompt)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Println("cancelled")
+				return nil
+			}
+		}
+		if *others {
+			return cl.TerminateOtherSessions(ctx)
+		}
+		return cl.TerminateSession(ctx, *terminate)
+	}
+
+	sessions, err := cl.Sessions(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "HASH\tCURRENT\tAPP\tDEVICE\tIP\tCOUNTRY\tLAST ACTIVE")
+	for _, s := range sessions {
+		fmt.Fprintf(tw, "%d\t%t\t%s %s\t%s, %s\t%s\t%s\t%s\n",
+			s.Hash, s.Current, s.AppName, s.AppVersion, s.DeviceModel, s.Platform,
+			s.IP, s.Country, time.Unix(int64(s.DateActive), 0).Format(time.DateTime))
+	}
+	return nil
+}
+
+func confirm(r io.Reader, w io.Writer, prompt string) (bool, error) {
+	fmt.Fprintf(w, "%s [y/N] ", prompt)
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// oneLine returns the first line of s, truncated to n runes.
+func oneLine(s string, n int) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i] + "…"
+	}
+	if r := []rune(s); len(r) > n {
+		s = string(r[:n-1]) + "…"
+	}
+	return s
+}
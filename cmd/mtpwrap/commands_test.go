@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_confirm(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{"yes", "y\n", true},
+		{"yes, full", " YES \n", true},
+		{"no", "n\n", false},
+		{"default", "\n", false},
+		{"eof", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := confirm(strings.NewReader(tt.input), &out, "Sure?")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, "Sure? [y/N] ", out.String())
+		})
+	}
+}
+
+func Test_oneLine(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{"short", "hello", 10, "hello"},
+		{"multiline", "hello\nworld", 10, "hello…"},
+		{"long", "hello world", 6, "hello…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, oneLine(tt.s, tt.n))
+		})
+	}
+}
@@ -0,0 +1,240 @@
+// Command mtpwrap is the command line tool for the common mtpwrap workflows:
+// logging in, listing dialogs, searching, deleting and exporting own messages.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/rusq/mtpwrap"
+	"github.com/rusq/mtpwrap/authflow"
+)
+
+const (
+	envAPIID   = "MTPWRAP_API_ID"
+	envAPIHash = "MTPWRAP_API_HASH"
+)
+
+type params struct {
+	apiID       int
+	apiHash     string
+	sessionFile string
+	credsFile   string
+	phone       string
+	signUp      bool
+	webLogin    string
+	proxy       string
+	debug       bool
+	reset       bool
+	config      string
+
+	// cfg is the effective configuration: the configuration file and the
+	// environment, overridden by the flags.
+	cfg mtpwrap.FileConfig
+}
+
+// command is the subcommand of the tool.
+type command struct {
+	name  string
+	short string
+	// run runs the command.  If it is nil, runNoClient is called.
+	run         func(ctx context.Context, cl *mtpwrap.Client, args []string) error
+	runNoClient func(ctx context.Context, p params, args []string) error
+}
+
+var commands = []command{
+	{name: "login", short: "log in to telegram and save the session", run: runLogin},
+	{name: "list", short: "list chats, channels or users", run: runList},
+	{name: "search", short: "search own messages in a chat or channel", run: runSearch},
+	{name: "delete", short: "delete own messages in a chat or channel", run: runDelete},
+	{name: "export", short: "export message history of a chat or channel", run: runExport},
+	{name: "sessions", short: "list or terminate the active sessions", run: runSessions},
+	{name: "reset", short: "remove the stored credentials and session", runNoClient: runReset},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	var p params
+	fs := flag.NewFlagSet("mtpwrap", flag.ContinueOnError)
+	fs.Usage = func() { usage(fs) }
+	fs.IntVar(&p.apiID, "api-id", 0, "telegram API ID (env: "+envAPIID+")")
+	fs.StringVar(&p.apiHash, "api-hash", "", "telegram API hash (env: "+envAPIHash+")")
+	fs.StringVar(&p.sessionFile, "session", defaultPath("session.json"), "session `file`")
+	fs.StringVar(&p.credsFile, "creds", defaultPath("creds.dat"), "encrypted API credentials `file`")
+	fs.StringVar(&p.phone, "phone", "", "phone number in international format")
+	fs.BoolVar(&p.signUp, "signup", false, "register a new account, if the phone number is not registered")
+	fs.StringVar(&p.webLogin, "web-login", "", "serve the login page on the localhost `address`, i.e. 127.0.0.1:8080, instead of the terminal login")
+	fs.StringVar(&p.proxy, "proxy", "", "proxy `URL`: tg://proxy, tg://socks link or socks5://[user:pass@]host:port (env: "+mtpwrap.EnvProxy+" or ALL_PROXY)")
+	fs.BoolVar(&p.debug, "debug", false, "enable telegram client debug output")
+	fs.BoolVar(&p.reset, "reset", false, "remove the stored credentials and session before running")
+	fs.StringVar(&p.config, "config", "", "configuration `file` (.yaml, .json or .toml), the flags override its settings")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if err := loadConfig(fs, &p); err != nil {
+		return err
+	}
+
+	if p.reset {
+		if err := runReset(ctx, p, nil); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			return nil
+		}
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("command is required")
+	}
+
+	cmd, ok := findCommand(fs.Arg(0))
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown command: %q", fs.Arg(0))
+	}
+	if cmd.run == nil {
+		return cmd.runNoClient(ctx, p, fs.Args()[1:])
+	}
+
+	flow, closeFlow, err := newAuthFlow(p)
+	if err != nil {
+		return err
+	}
+	defer closeFlow()
+
+	cl, err := newClient(ctx, p, flow)
+	if err != nil {
+		return err
+	}
+	if p.cfg.Debug {
+		fmt.Fprint(os.Stderr, cl.Config())
+	}
+	if err := cl.Start(ctx); err != nil {
+		return err
+	}
+	defer cl.Stop()
+
+	return cmd.run(ctx, cl, fs.Args()[1:])
+}
+
+// loadConfig reads the configuration file, if it's set, and the MTPWRAP_*
+// environment variables into p.cfg.  The flags, set on the command line,
+// override them, and the flag defaults are used for the settings, that are
+// not set.
+func loadConfig(fs *flag.FlagSet, p *params) error {
+	cfg, err := mtpwrap.LoadConfig(p.config)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	override := func(name string, dst *string, val string) {
+		if set[name] || *dst == "" {
+			*dst = val
+		}
+	}
+	if set["api-id"] || cfg.APIID == 0 {
+		cfg.APIID = p.apiID
+	}
+	override("api-hash", &cfg.APIHash, p.apiHash)
+	override("session", &cfg.Session, p.sessionFile)
+	override("creds", &cfg.CredsFile, p.credsFile)
+	override("phone", &cfg.Phone, p.phone)
+	override("proxy", &cfg.Proxy, p.proxy)
+	if set["signup"] {
+		cfg.SignUp = p.signUp
+	}
+	if set["debug"] {
+		cfg.Debug = p.debug
+	}
+	p.cfg = cfg
+	return nil
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] <command> [command flags]\n\nCommands:\n", fs.Name())
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(out, "\nRun '%s <command> -h' for the command help.\n\nFlags:\n", fs.Name())
+	fs.PrintDefaults()
+}
+
+// newAuthFlow returns the authentication flow and the function that releases
+// its resources.
+func newAuthFlow(p params) (authflow.FullAuthFlow, func() error, error) {
+	if p.webLogin == "" {
+		return authflow.NewTermAuth(p.cfg.Phone, authflow.WithSignUp(p.cfg.SignUp)), func() error { return nil }, nil
+	}
+	w, err := authflow.NewWebAuth(p.webLogin, authflow.WithWebPhone(p.cfg.Phone), authflow.WithWebSignUp(p.cfg.SignUp))
+	if err != nil {
+		return nil, nil, err
+	}
+	return w, w.Close, nil
+}
+
+func newClient(ctx context.Context, p params, flow authflow.FullAuthFlow) (*mtpwrap.Client, error) {
+	if err := os.MkdirAll(filepath.Dir(p.cfg.Session), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.cfg.CredsFile), 0700); err != nil {
+		return nil, err
+	}
+	cfgOpts, err := p.cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	// ALL_PROXY is used, unless the proxy is configured.
+	opts := append([]mtpwrap.Option{mtpwrap.WithProxyFromEnv()}, cfgOpts...)
+	opts = append(opts, mtpwrap.WithAuth(flow))
+	return mtpwrap.New(ctx, p.cfg.APIID, p.cfg.APIHash, opts...)
+}
+
+func runReset(_ context.Context, p params, _ []string) error {
+	for _, name := range []string{p.cfg.CredsFile, p.cfg.Session} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	fmt.Println("stored credentials and session removed")
+	return nil
+}
+
+// defaultPath returns the path of the file in the user's configuration
+// directory.
+func defaultPath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(dir, "mtpwrap", name)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rusq/mtpwrap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFlags returns the flag set with the flags, that loadConfig applies.
+func testFlags(p *params) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.IntVar(&p.apiID, "api-id", 0, "")
+	fs.StringVar(&p.apiHash, "api-hash", "", "")
+	fs.StringVar(&p.sessionFile, "session", "default.json", "")
+	fs.StringVar(&p.phone, "phone", "", "")
+	fs.BoolVar(&p.debug, "debug", false, "")
+	return fs
+}
+
+func Test_loadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte("api_id = 1\napi_hash = \"hash\"\nphone = \"+6422123456\"\ndebug = true\nhealth_check = \"1m\"\n"), 0600))
+	t.Setenv("MTPWRAP_PHONE", "+6422000000")
+
+	var p params
+	fs := testFlags(&p)
+	require.NoError(t, fs.Parse([]string{"-api-id", "2", "-debug=false"}))
+	p.config = path
+
+	require.NoError(t, loadConfig(fs, &p))
+	assert.Equal(t, 2, p.cfg.APIID, "flag must override the config")
+	assert.False(t, p.cfg.Debug, "flag must override the config")
+	assert.Equal(t, "hash", p.cfg.APIHash)
+	assert.Equal(t, "+6422000000", p.cfg.Phone, "environment must override the config")
+	assert.Equal(t, "default.json", p.cfg.Session, "flag default must be used, if not set")
+	assert.Equal(t, mtpwrap.Duration(time.Minute), p.cfg.HealthCheck)
+}
+
+func Test_loadConfigEnv(t *testing.T) {
+	t.Setenv("MTPWRAP_API_ID", "3")
+	t.Setenv("MTPWRAP_SESSION", "env.json")
+	t.Setenv("MTPWRAP_PEER_STORAGE", "bolt")
+
+	var p params
+	fs := testFlags(&p)
+	require.NoError(t, fs.Parse(nil))
+	require.NoError(t, loadConfig(fs, &p))
+	assert.Equal(t, 3, p.cfg.APIID, "environment must be read without the config file")
+	assert.Equal(t, "env.json", p.cfg.Session)
+
+	_, err := newClient(context.Background(), p, nil)
+	assert.ErrorContains(t, err, "peer storage", "settings must be validated")
+}
@@ -0,0 +1,147 @@
+package mtpwrap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+)
+
+// ErrOptionConflict is returned by New, if two different options set the
+// same setting.
+var ErrOptionConflict = errors.New("conflicting options")
+
+// setOpt records that the option opt set the telegram.Options field.  If the
+// field was already set by the other option, the conflict is reported by New.
+func (c *Client) setOpt(field, opt string) {
+	if prev, ok := c.optSrc[field]; ok && prev != opt {
+		c.optErr = errors.Join(c.optErr, fmt.Errorf("%w: %s is set by both %s and %s", ErrOptionConflict, field, prev, opt))
+	}
+	c.optSrc[field] = opt
+}
+
+// validate reports the option errors and the conflicting or invalid
+// settings.
+func (c *Client) validate() error {
+	errs := []error{c.optErr}
+	if c.auth == nil {
+		errs = append(errs, errors.New("authentication flow is not set"))
+	}
+	if c.healthInterval < 0 {
+		errs = append(errs, errors.New("health check interval must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// mergeOptions copies the non-zero fields of src to dst, the middlewares are
+// appended.  It returns the names of the copied fields, except middlewares.
+func mergeOptions(dst *telegram.Options, src telegram.Options) []string {
+	var (
+		dv     = reflect.ValueOf(dst).Elem()
+		sv     = reflect.ValueOf(src)
+		fields []string
+	)
+	for i := 0; i < sv.NumField(); i++ {
+		f := sv.Field(i)
+		if f.IsZero() {
+			continue
+		}
+		name := sv.Type().Field(i).Name
+		if f.Kind() == reflect.Slice && name == "Middlewares" {
+			dv.Field(i).Set(reflect.AppendSlice(dv.Field(i), f))
+			continue
+		}
+		dv.Field(i).Set(f)
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// Config is the effective configuration of the client.  It's intended for
+// debugging, and doesn't contain the secrets.
+type Config struct {
+	AppID          int
+	SessionStorage string // type of the session storage, and the path, if it's a file
+	PeerStorage    string // type of the peer storage
+	CredsFile      string
+	Auth           string // type of the authentication flow
+	Proxy          string // proxy URL, without the credentials
+	Debug          bool
+	HealthCheck    time.Duration
+	Archive        bool
+	DC             int
+	Middlewares    int // number of the telegram middlewares
+	// Sources maps the telegram.Options fields to the options, that set
+	// them.
+	Sources map[string]string
+}
+
+// Config returns the effective configuration of the client.
+func (c *Client) Config() Config {
+	cfg := Config{
+		AppID:       c.creds.ID,
+		PeerStorage: typeName(c.peerStrg),
+		CredsFile:   c.credsStrg.filename,
+		Auth:        typeName(c.auth),
+		Debug:       c.telegramOpts.Logger != nil,
+		HealthCheck: c.healthInterval,
+		Archive:     c.archive != nil,
+		DC:          c.telegramOpts.DC,
+		Middlewares: len(c.telegramOpts.Middlewares),
+		Sources:     make(map[string]string, len(c.optSrc)),
+	}
+	switch s := c.telegramOpts.SessionStorage.(type) {
+	case nil:
+	case *session.FileStorage:
+		cfg.SessionStorage = typeName(s) + " " + s.Path
+	default:
+		cfg.SessionStorage = typeName(s)
+	}
+	if c.proxy != nil {
+		cfg.Proxy = c.proxy.String()
+	}
+	for k, v := range c.optSrc {
+		cfg.Sources[k] = v
+	}
+	return cfg
+}
+
+// String returns the configuration, one setting per line.
+func (cfg Config) String() string {
+	var sb strings.Builder
+	line := func(name string, v any) {
+		fmt.Fprintf(&sb, "%-16s %v\n", name+":", v)
+	}
+	line("app id", cfg.AppID)
+	line("session storage", cfg.SessionStorage)
+	line("peer storage", cfg.PeerStorage)
+	line("creds file", cfg.CredsFile)
+	line("auth", cfg.Auth)
+	line("proxy", cfg.Proxy)
+	line("debug", cfg.Debug)
+	line("health check", cfg.HealthCheck)
+	line("archive", cfg.Archive)
+	line("dc", cfg.DC)
+	line("middlewares", cfg.Middlewares)
+	fields := make([]string, 0, len(cfg.Sources))
+	for k := range cfg.Sources {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	for _, k := range fields {
+		line("option "+k, cfg.Sources[k])
+	}
+	return sb.String()
+}
+
+func typeName(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", v)
+}
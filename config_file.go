@@ -0,0 +1,362 @@
+package mtpwrap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rusq/mtpwrap/authflow"
+)
+
+// ConfigFormat is the format of the configuration file.
+type ConfigFormat int
+
+const (
+	ConfigYAML ConfigFormat = iota + 1
+	ConfigJSON
+	ConfigTOML
+)
+
+// FileConfig is the client configuration, read from the file.  Each setting
+// can be overridden with the environment variable in the env tag.
+type FileConfig struct {
+	APIID   int    `json:"api_id" yaml:"api_id" env:"MTPWRAP_API_ID"`
+	APIHash string `json:"api_hash" yaml:"api_hash" env:"MTPWRAP_API_HASH"`
+	// Session is the session file, see WithStorage.
+	Session string `json:"session" yaml:"session" env:"MTPWRAP_SESSION"`
+	// CredsFile is the encrypted API credentials file, see
+	// WithApiCredsFile.
+	CredsFile string `json:"creds_file" yaml:"creds_file" env:"MTPWRAP_CREDS_FILE"`
+	Debug     bool   `json:"debug" yaml:"debug" env:"MTPWRAP_DEBUG"`
+	// Proxy is the proxy URL, see ParseProxyURL.
+	Proxy string `json:"proxy" yaml:"proxy" env:"MTPWRAP_PROXY"`
+	// PeerStorage is the peer storage type, only "memory" is supported.
+	PeerStorage string `json:"peer_storage" yaml:"peer_storage" env:"MTPWRAP_PEER_STORAGE"`
+	// HealthCheck is the connection health check interval, see
+	// WithHealthCheck.
+	HealthCheck Duration `json:"health_check" yaml:"health_check" env:"MTPWRAP_HEALTH_CHECK"`
+	// Phone is the phone number for the terminal authentication.
+	Phone string `json:"phone" yaml:"phone" env:"MTPWRAP_PHONE"`
+	// SignUp allows to register the new account on login.
+	SignUp bool `json:"signup" yaml:"signup" env:"MTPWRAP_SIGNUP"`
+}
+
+// Duration is the time.Duration, that is read from the string, i.e. "30s".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// NewFromConfig creates the client from the configuration file, see
+// LoadConfig.  opts are applied after the options from the configuration.
+func NewFromConfig(ctx context.Context, path string, opts ...Option) (*Client, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	cfgOpts, err := cfg.Options()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return New(ctx, cfg.APIID, cfg.APIHash, append(cfgOpts, opts...)...)
+}
+
+// LoadConfig reads the configuration file, and applies the overrides from
+// the environment.  The format is detected by the file extension: .yaml or
+// .yml, .json, or .toml.  If path is empty, only the environment is read.
+func LoadConfig(path string) (FileConfig, error) {
+	var cfg FileConfig
+	if path != "" {
+		var err error
+		if cfg, err = readConfigFile(path); err != nil {
+			return FileConfig{}, err
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return FileConfig{}, err
+	}
+	return cfg, nil
+}
+
+func readConfigFile(path string) (FileConfig, error) {
+	format, err := configFormat(path)
+	if err != nil {
+		return FileConfig{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return FileConfig{}, err
+	}
+	defer f.Close()
+	cfg, err := ReadConfig(f, format)
+	if err != nil {
+		return FileConfig{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func configFormat(path string) (ConfigFormat, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		return ConfigYAML, nil
+	case ".json":
+		return ConfigJSON, nil
+	case ".toml":
+		return ConfigTOML, nil
+	default:
+		return 0, fmt.Errorf("unsupported config file extension: %q", ext)
+	}
+}
+
+// ReadConfig reads the configuration in the format from r.  Unknown settings
+// are reported as errors.  Only the flat TOML documents with key = value
+// pairs are supported.
+func ReadConfig(r io.Reader, format ConfigFormat) (FileConfig, error) {
+	var cfg FileConfig
+	switch format {
+	case ConfigYAML:
+		dec := yaml.NewDecoder(r)
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return FileConfig{}, err
+		}
+	case ConfigJSON:
+		if err := decodeJSON(r, &cfg); err != nil {
+			return FileConfig{}, err
+		}
+	case ConfigTOML:
+		m, err := parseTOML(r)
+		if err != nil {
+			return FileConfig{}, err
+		}
+		// the values have the same types in JSON, so the decoding rules
+		// are shared.
+		b, err := json.Marshal(m)
+		if err != nil {
+			return FileConfig{}, err
+		}
+		if err := decodeJSON(bytes.NewReader(b), &cfg); err != nil {
+			return FileConfig{}, err
+		}
+	default:
+		return FileConfig{}, fmt.Errorf("unsupported config format: %d", format)
+	}
+	return cfg, nil
+}
+
+func decodeJSON(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// applyEnv overrides the settings with the values of the environment
+// variables, set in the env tags.
+func (cfg *FileConfig) applyEnv(lookup func(string) (string, bool)) error {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		val, ok := lookup(name)
+		if name == "" || !ok {
+			continue
+		}
+		if err := setField(v.Field(i), val); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+func setField(f reflect.Value, val string) error {
+	if f.Type() == durationType {
+		return f.Addr().Interface().(*Duration).UnmarshalText([]byte(val))
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Int:
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type: %s", f.Type())
+	}
+	return nil
+}
+
+// Options returns the client options for the configuration.
+func (cfg FileConfig) Options() ([]Option, error) {
+	var opts []Option
+	if cfg.Session != "" {
+		opts = append(opts, WithStorage(cfg.Session))
+	}
+	if cfg.CredsFile != "" {
+		opts = append(opts, WithApiCredsFile(cfg.CredsFile))
+	}
+	if cfg.Debug {
+		opts = append(opts, WithDebug(true))
+	}
+	if cfg.Proxy != "" {
+		opts = append(opts, WithProxyURL(cfg.Proxy))
+	}
+	switch strings.ToLower(cfg.PeerStorage) {
+	case "", "memory":
+	default:
+		return nil, fmt.Errorf("unsupported peer storage: %q", cfg.PeerStorage)
+	}
+	if cfg.HealthCheck < 0 {
+		return nil, errors.New("health check interval must not be negative")
+	} else if cfg.HealthCheck > 0 {
+		opts = append(opts, WithHealthCheck(time.Duration(cfg.HealthCheck)))
+	}
+	if cfg.Phone != "" || cfg.SignUp {
+		opts = append(opts, WithAuth(authflow.NewTermAuth(cfg.Phone, authflow.WithSignUp(cfg.SignUp))))
+	}
+	return opts, nil
+}
+
+// parseTOML parses the flat TOML document: key = value pairs, where the
+// value is a string, an integer, a float or a boolean.  Tables and arrays are
+// not supported.
+func parseTOML(r io.Reader) (map[string]any, error) {
+	var (
+		m  = make(map[string]any)
+		sc = bufio.NewScanner(r)
+		n  int
+	)
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			return nil, fmt.Errorf("line %d: tables are not supported", n)
+		}
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key = strings.TrimSpace(key)
+		if k, err := strconv.Unquote(key); err == nil {
+			key = k
+		}
+		if key == "" {
+			return nil, fmt.Errorf("line %d: empty key", n)
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", n, key)
+		}
+		val, err := parseTOMLValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, key, err)
+		}
+		m[key] = val
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseTOMLValue(s string) (any, error) {
+	switch {
+	case s == "":
+		return nil, errors.New("missing value")
+	case s[0] == '"':
+		end := closingQuote(s)
+		if end < 0 {
+			return nil, errors.New("unterminated string")
+		}
+		if err := trailingComment(s[end+1:]); err != nil {
+			return nil, err
+		}
+		return strconv.Unquote(s[:end+1])
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, errors.New("unterminated string")
+		}
+		if err := trailingComment(s[end+2:]); err != nil {
+			return nil, err
+		}
+		return s[1 : end+1], nil
+	}
+	// bare value, possibly followed by the comment.
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	num := strings.ReplaceAll(s, "_", "")
+	if i, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unsupported value: %s", s)
+}
+
+// closingQuote returns the index of the quote, closing the basic string,
+// that starts at s[0], or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// trailingComment returns an error, if s is not empty or a comment.
+func trailingComment(s string) error {
+	s = strings.TrimSpace(s)
+	if s != "" && s[0] != '#' {
+		return fmt.Errorf("unexpected text after value: %s", s)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package mtpwrap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFileConfig = FileConfig{
+	APIID:       12345,
+	APIHash:     "hash",
+	Session:     "session.json",
+	CredsFile:   "creds.dat",
+	Debug:       true,
+	Proxy:       "socks5://127.0.0.1:1080",
+	PeerStorage: "memory",
+	HealthCheck: Duration(30 * time.Second),
+	Phone:       "+6422123456",
+}
+
+const (
+	testYAML = `# client config
+api_id: 12345
+api_hash: hash
+session: session.json
+creds_file: creds.dat
+debug: true
+proxy: socks5://127.0.0.1:1080
+peer_storage: memory
+health_check: 30s
+phone: "+6422123456"
+`
+	testJSON = `{
+	"api_id": 12345,
+	"api_hash": "hash",
+	"session": "session.json",
+	"creds_file": "creds.dat",
+	"debug": true,
+	"proxy": "socks5://127.0.0.1:1080",
+	"peer_storage": "memory",
+	"health_check": "30s",
+	"phone": "+6422123456"
+}`
+	testTOML = `# client config
+api_id = 12_345
+api_hash = 'hash'
+session = "session.json" # comment
+creds_file = "creds.dat"
+debug = true
+proxy = "socks5://127.0.0.1:1080"
+"peer_storage" = "memory"
+health_check = "30s"
+phone = "+6422123456"
+`
+)
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		format ConfigFormat
+		input  string
+	}{
+		{"yaml", ConfigYAML, testYAML},
+		{"json", ConfigJSON, testJSON},
+		{"toml", ConfigTOML, testTOML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadConfig(strings.NewReader(tt.input), tt.format)
+			require.NoError(t, err)
+			assert.Equal(t, testFileConfig, got)
+		})
+		t.Run(tt.name+" unknown setting", func(t *testing.T) {
+			input := map[ConfigFormat]string{
+				ConfigYAML: "api_idd: 1\n",
+				ConfigJSON: `{"api_idd": 1}`,
+				ConfigTOML: "api_idd = 1\n",
+			}[tt.format]
+			_, err := ReadConfig(strings.NewReader(input), tt.format)
+			assert.Error(t, err)
+		})
+		t.Run(tt.name+" empty", func(t *testing.T) {
+			got, err := ReadConfig(strings.NewReader(""), tt.format)
+			assert.NoError(t, err)
+			assert.Equal(t, FileConfig{}, got)
+		})
+	}
+}
+
+func Test_parseTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			"values",
+			"s = \"a \\\"quoted\\\" # not a comment\"\nl = 'C:\\path'\ni = 0x10\nf = 1.5\nb = false # comment\n",
+			map[string]any{"s": `a "quoted" # not a comment`, "l": `C:\path`, "i": int64(16), "f": 1.5, "b": false},
+			false,
+		},
+		{"table", "[client]\napi_id = 1\n", nil, true},
+		{"duplicate key", "a = 1\na = 2\n", nil, true},
+		{"missing value", "a =\n", nil, true},
+		{"no equals", "a\n", nil, true},
+		{"unterminated string", "a = \"abc\n", nil, true},
+		{"text after string", "a = \"abc\" def\n", nil, true},
+		{"array", "a = [1, 2]\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTOML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFileConfig_applyEnv(t *testing.T) {
+	env := map[string]string{
+		"MTPWRAP_API_ID":       "54321",
+		"MTPWRAP_DEBUG":        "false",
+		"MTPWRAP_HEALTH_CHECK": "1m",
+		"MTPWRAP_PROXY":        "",
+	}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+	cfg := testFileConfig
+	require.NoError(t, cfg.applyEnv(lookup))
+	assert.Equal(t, 54321, cfg.APIID)
+	assert.False(t, cfg.Debug)
+	assert.Equal(t, Duration(time.Minute), cfg.HealthCheck)
+	assert.Empty(t, cfg.Proxy, "set to empty value must override")
+	assert.Equal(t, "hash", cfg.APIHash, "not set must not override")
+
+	env["MTPWRAP_API_ID"] = "abc"
+	assert.ErrorContains(t, cfg.applyEnv(lookup), "MTPWRAP_API_ID")
+}
+
+func TestNewFromConfig(t *testing.T) {
+	t.Setenv("MTPWRAP_API_HASH", "env hash")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testYAML), 0600))
+
+	c, err := NewFromConfig(context.Background(), path, WithHealthCheck(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "env hash", c.creds.Hash)
+	cfg := c.Config()
+	assert.Equal(t, 12345, cfg.AppID)
+	assert.Equal(t, "*session.FileStorage session.json", cfg.SessionStorage)
+	assert.Equal(t, "creds.dat", cfg.CredsFile)
+	assert.True(t, cfg.Debug)
+	assert.Equal(t, "socks5://127.0.0.1:1080", cfg.Proxy)
+	assert.Equal(t, time.Minute, cfg.HealthCheck, "options must be applied after the config")
+
+	_, err = NewFromConfig(context.Background(), filepath.Join(dir, "config.ini"))
+	assert.Error(t, err)
+
+	bad := filepath.Join(dir, "bad.json")
+	require.NoError(t, os.WriteFile(bad, []byte(`{"peer_storage": "bolt"}`), 0600))
+	_, err = NewFromConfig(context.Background(), bad)
+	assert.ErrorContains(t, err, "peer storage")
+}
+
+func TestLoadConfig_envOnly(t *testing.T) {
+	t.Setenv("MTPWRAP_API_ID", "54321")
+	t.Setenv("MTPWRAP_HEALTH_CHECK", "1m")
+	got, err := LoadConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, FileConfig{APIID: 54321, HealthCheck: Duration(time.Minute)}, got)
+}
@@ -0,0 +1,108 @@
+package mtpwrap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNew_optionsMerge(t *testing.T) {
+	logger := zap.NewNop()
+	mw := telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			return next.Invoke(ctx, input, output)
+		}
+	})
+	mtpOpts := WithMTPOptions(telegram.Options{Logger: logger, DC: 4, Middlewares: []telegram.Middleware{mw}})
+
+	orders := map[string][]Option{
+		"mtp options last":  {WithStorage("session.json"), mtpOpts},
+		"mtp options first": {mtpOpts, WithStorage("session.json")},
+	}
+	for name, opts := range orders {
+		t.Run(name, func(t *testing.T) {
+			c, err := New(context.Background(), 12345, "hash", opts...)
+			require.NoError(t, err)
+			assert.Equal(t, &session.FileStorage{Path: "session.json"}, c.telegramOpts.SessionStorage)
+			assert.Same(t, logger, c.telegramOpts.Logger)
+			assert.Equal(t, 4, c.telegramOpts.DC)
+			// own middleware, flood waiter and the in-flight tracker.
+			assert.Len(t, c.telegramOpts.Middlewares, 3)
+		})
+	}
+}
+
+func TestNew_optionsConflict(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{
+			"session storage",
+			[]Option{WithStorage("a.json"), WithMTPOptions(telegram.Options{SessionStorage: &session.StorageMemory{}})},
+		},
+		{
+			"logger",
+			[]Option{WithMTPOptions(telegram.Options{Logger: zap.NewNop()}), WithDebug(true)},
+		},
+		{
+			"resolver and proxy",
+			[]Option{WithMTPOptions(telegram.Options{Resolver: dcs.Plain(dcs.PlainOptions{})}), WithSOCKS5Proxy("127.0.0.1:1080", "", "")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(context.Background(), 12345, "hash", tt.opts...)
+			assert.ErrorIs(t, err, ErrOptionConflict)
+		})
+	}
+}
+
+func TestNew_validate(t *testing.T) {
+	_, err := New(context.Background(), 12345, "hash", WithAuth(nil))
+	assert.Error(t, err)
+	_, err = New(context.Background(), 12345, "hash", WithHealthCheck(-time.Second))
+	assert.Error(t, err)
+}
+
+func TestWithDebug_disable(t *testing.T) {
+	logger := zap.NewNop()
+	c, err := New(context.Background(), 12345, "hash", WithMTPOptions(telegram.Options{Logger: logger}), WithDebug(false))
+	require.NoError(t, err)
+	assert.Same(t, logger, c.telegramOpts.Logger, "must not remove the logger set by another option")
+
+	c, err = New(context.Background(), 12345, "hash", WithDebug(true), WithDebug(false))
+	require.NoError(t, err)
+	assert.Nil(t, c.telegramOpts.Logger)
+}
+
+func TestClient_Config(t *testing.T) {
+	c, err := New(context.Background(), 12345, "hash",
+		WithStorage("session.json"),
+		WithSOCKS5Proxy("127.0.0.1:1080", "bob", "secret"),
+		WithHealthCheck(time.Minute),
+	)
+	require.NoError(t, err)
+	cfg := c.Config()
+	assert.Equal(t, 12345, cfg.AppID)
+	assert.Equal(t, "*session.FileStorage session.json", cfg.SessionStorage)
+	assert.Equal(t, "*mtpwrap.MemStorage", cfg.PeerStorage)
+	assert.Equal(t, "authflow.TermAuth", cfg.Auth)
+	assert.Equal(t, "socks5://127.0.0.1:1080", cfg.Proxy)
+	assert.Equal(t, time.Minute, cfg.HealthCheck)
+	assert.Equal(t, map[string]string{"SessionStorage": "WithStorage", "Resolver": "proxy option"}, cfg.Sources)
+
+	s := cfg.String()
+	assert.Contains(t, s, "option Resolver:")
+	assert.NotContains(t, s, "secret")
+	assert.NotContains(t, s, "hash")
+}
@@ -0,0 +1,358 @@
+package mtpwrap
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
+
+// Contact is the phone book entry.
+type Contact struct {
+	Phone     string
+	FirstName string
+	LastName  string
+}
+
+// Contacts returns the contacts of the current user.  The contacts are added
+// to the peer storage.
+func (c *Client) Contacts(ctx context.Context) ([]*tg.User, error) {
+	resp, err := c.api().ContactsGetContacts(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	cc, ok := resp.(*tg.ContactsContacts)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response type: %T", resp)
+	}
+	if err := c.addPeers(ctx, cc.Users, nil); err != nil {
+		return nil, err
+	}
+	return usersOf(cc.Users), nil
+}
+
+// ImportContacts adds the contacts to the current user's phone book.  It
+// returns the users, that were found by the phone numbers, they are added to
+// the peer storage.
+func (c *Client) ImportContacts(ctx context.Context, contacts []Contact) ([]*tg.User, error) {
+	chunks := splitBy(defBatchSize, contacts, func(i int) tg.InputPhoneContact {
+		return tg.InputPhoneContact{
+			ClientID:  int64(i),
+			Phone:     contacts[i].Phone,
+			FirstName: contacts[i].FirstName,
+			LastName:  contacts[i].LastName,
+		}
+	})
+	var users []*tg.User
+	for _, chunk := range chunks {
+		resp, err := c.api().ContactsImportContacts(ctx, chunk)
+		if err != nil {
+			return users, err
+		}
+		if len(resp.RetryContacts) > 0 {
+			Log.Printf("%d contacts were not imported due to the limits, retry later", len(resp.RetryContacts))
+		}
+		if err := c.addPeers(ctx, resp.Users, nil); err != nil {
+			return users, err
+		}
+		users = append(users, usersOf(resp.Users)...)
+	}
+	return users, nil
+}
+
+// DeleteContacts deletes the users from the current user's phone book.
+func (c *Client) DeleteContacts(ctx context.Context, users ...tg.InputUserClass) error {
+	if len(users) == 0 {
+		return nil
+	}
+	_, err := c.api().ContactsDeleteContacts(ctx, users)
+	return err
+}
+
+// BlockUser adds the user or chat to the block list.
+func (c *Client) BlockUser(ctx context.Context, peer tg.InputPeerClass) error {
+	_, err := c.api().ContactsBlock(ctx, &tg.ContactsBlockRequest{ID: peer})
+	return err
+}
+
+// UnblockUser removes the user or chat from the block list.
+func (c *Client) UnblockUser(ctx context.Context, peer tg.InputPeerClass) error {
+	_, err := c.api().ContactsUnblock(ctx, &tg.ContactsUnblockRequest{ID: peer})
+	return err
+}
+
+// SearchUsers searches users, chats and channels by name or username, both
+// among the known peers and globally.  It returns at most limit results of
+// each kind, the results are added to the peer storage.
+func (c *Client) SearchUsers(ctx context.Context, q string, limit int) ([]Entity, error) {
+	if limit <= 0 {
+		limit = defBatchSize
+	}
+	resp, err := c.api().ContactsSearch(ctx, &tg.ContactsSearchRequest{Q: q, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.addPeers(ctx, resp.Users, resp.Chats); err != nil {
+		return nil, err
+	}
+	var ee []Entity
+	for _, p := range append(resp.MyResults, resp.Results...) {
+		if ent, ok := entityFor(p, resp.Users, resp.Chats); ok {
+			ee = append(ee, ent)
+		}
+	}
+	return ee, nil
+}
+
+// ExportContacts writes the contacts of the current user to w in the format,
+// which is either ContactsCSV or ContactsVCard.  It returns the number of
+// contacts written.
+func (c *Client) ExportContacts(ctx context.Context, w io.Writer, format ContactFormat) (int, error) {
+	users, err := c.Contacts(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cc := make([]Contact, len(users))
+	for i, u := range users {
+		cc[i] = Contact{Phone: u.Phone, FirstName: u.FirstName, LastName: u.LastName}
+	}
+	if err := WriteContacts(w, cc, format); err != nil {
+		return 0, err
+	}
+	return len(cc), nil
+}
+
+func usersOf(uu []tg.UserClass) []*tg.User {
+	var users []*tg.User
+	for _, u := range uu {
+		if user, ok := u.(*tg.User); ok {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// ContactFormat is the format of the contacts file.
+type ContactFormat int
+
+const (
+	ContactsCSV   ContactFormat = iota // comma separated values with header
+	ContactsVCard                      // vCard 3.0
+)
+
+var contactCSVHeader = []string{"phone", "first_name", "last_name"}
+
+// ReadContacts reads the contacts from r in the format, which is either
+// ContactsCSV or ContactsVCard.  The CSV must have the header with the
+// "phone", "first_name" and optional "last_name" columns, in any order.
+func ReadContacts(r io.Reader, format ContactFormat) ([]Contact, error) {
+	switch format {
+	case ContactsCSV:
+		return readContactsCSV(r)
+	case ContactsVCard:
+		return readVCards(r)
+	default:
+		return nil, fmt.Errorf("unsupported contacts format: %d", format)
+	}
+}
+
+func readContactsCSV(r io.Reader) ([]Contact, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	col := make(map[string]int, len(header))
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, required := range contactCSVHeader[:2] {
+		if _, ok := col[required]; !ok {
+			return nil, fmt.Errorf("missing column: %s", required)
+		}
+	}
+	field := func(rec []string, name string) string {
+		i, ok := col[name]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var cc []Contact
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		ct := Contact{
+			Phone:     field(rec, "phone"),
+			FirstName: field(rec, "first_name"),
+			LastName:  field(rec, "last_name"),
+		}
+		if ct.Phone == "" {
+			continue
+		}
+		cc = append(cc, ct)
+	}
+	return cc, nil
+}
+
+// readVCards reads the name and the first phone number of each vCard.
+func readVCards(r io.Reader) ([]Contact, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		cc  []Contact
+		cur *Contact
+		fn  string
+	)
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		// strip the parameters, i.e. TEL;TYPE=CELL
+		prop, _, _ := strings.Cut(strings.ToUpper(name), ";")
+		// strip the group, i.e. item1.TEL
+		if i := strings.LastIndexByte(prop, '.'); i >= 0 {
+			prop = prop[i+1:]
+		}
+		switch prop {
+		case "BEGIN":
+			cur, fn = &Contact{}, ""
+		case "END":
+			if cur == nil {
+				continue
+			}
+			if cur.FirstName == "" && cur.LastName == "" {
+				cur.FirstName = fn
+			}
+			if cur.Phone != "" {
+				cc = append(cc, *cur)
+			}
+			cur = nil
+		case "N":
+			if cur == nil {
+				continue
+			}
+			parts := splitVCardValue(value)
+			if len(parts) > 0 {
+				cur.LastName = parts[0]
+			}
+			if len(parts) > 1 {
+				cur.FirstName = parts[1]
+			}
+		case "FN":
+			fn = unescapeVCard(value)
+		case "TEL":
+			if cur != nil && cur.Phone == "" {
+				cur.Phone = strings.TrimPrefix(strings.TrimSpace(value), "tel:")
+			}
+		}
+	}
+	return cc, nil
+}
+
+// maxVCardLine is the maximum length of the unfolded vCard line, i.e. the
+// inline base64 PHOTO.
+const maxVCardLine = 4 << 20
+
+// unfoldLines returns the lines of r, joining the folded lines, that start
+// with a space or tab.
+func unfoldLines(r io.Reader) ([]string, error) {
+	var (
+		lines []string
+		sc    = bufio.NewScanner(r)
+	)
+	sc.Buffer(nil, maxVCardLine)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading vCard: %w", err)
+	}
+	return lines, nil
+}
+
+// splitVCardValue splits the structured value by unescaped semicolons.
+func splitVCardValue(v string) []string {
+	var (
+		parts []string
+		sb    strings.Builder
+	)
+	for i := 0; i < len(v); i++ {
+		switch {
+		case v[i] == '\\' && i+1 < len(v):
+			sb.WriteByte(v[i])
+			sb.WriteByte(v[i+1])
+			i++
+		case v[i] == ';':
+			parts = append(parts, unescapeVCard(sb.String()))
+			sb.Reset()
+		default:
+			sb.WriteByte(v[i])
+		}
+	}
+	return append(parts, unescapeVCard(sb.String()))
+}
+
+var (
+	vcardEscaper   = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\n", `\n`)
+	vcardUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\,`, `,`, `\n`, "\n", `\N`, "\n")
+)
+
+func unescapeVCard(s string) string {
+	return vcardUnescaper.Replace(s)
+}
+
+// WriteContacts writes the contacts to w in the format, which is either
+// ContactsCSV or ContactsVCard.
+func WriteContacts(w io.Writer, contacts []Contact, format ContactFormat) error {
+	switch format {
+	case ContactsCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(contactCSVHeader); err != nil {
+			return err
+		}
+		for _, ct := range contacts {
+			if err := cw.Write([]string{ct.Phone, ct.FirstName, ct.LastName}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case ContactsVCard:
+		bw := bufio.NewWriter(w)
+		for _, ct := range contacts {
+			phone := ct.Phone
+			if phone != "" && !strings.HasPrefix(phone, "+") {
+				phone = "+" + phone
+			}
+			fmt.Fprintf(bw, "BEGIN:VCARD\r\nVERSION:3.0\r\nN:%s;%s;;;\r\nFN:%s\r\nTEL;TYPE=CELL:%s\r\nEND:VCARD\r\n",
+				vcardEscaper.Replace(ct.LastName),
+				vcardEscaper.Replace(ct.FirstName),
+				vcardEscaper.Replace(strings.TrimSpace(ct.FirstName+" "+ct.LastName)),
+				phone,
+			)
+		}
+		return bw.Flush()
+	default:
+		return fmt.Errorf("unsupported contacts format: %d", format)
+	}
+}
@@ -0,0 +1,126 @@
+package mtpwrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testContacts = []Contact{
+	{Phone: "+15550001", FirstName: "John", LastName: "Doe"},
+	{Phone: "+15550002", FirstName: "Jane; Mary", LastName: "Roe, Jr."},
+	{Phone: "+15550003", FirstName: "Solo"},
+}
+
+func TestContacts_roundtrip(t *testing.T) {
+	for _, format := range []ContactFormat{ContactsCSV, ContactsVCard} {
+		var buf bytes.Buffer
+		require.NoError(t, WriteContacts(&buf, testContacts, format))
+		got, err := ReadContacts(&buf, format)
+		require.NoError(t, err)
+		assert.Equal(t, testContacts, got, "format %d", format)
+	}
+	assert.Error(t, WriteContacts(&bytes.Buffer{}, testContacts, ContactFormat(42)))
+	_, err := ReadContacts(strings.NewReader(""), ContactFormat(42))
+	assert.Error(t, err)
+}
+
+func TestReadContacts_CSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Contact
+		wantErr bool
+	}{
+		{
+			"columns in any order, last name optional",
+			"First_Name,Phone\nJohn,+1555\n,\nJane,+1556\n",
+			[]Contact{{Phone: "+1555", FirstName: "John"}, {Phone: "+1556", FirstName: "Jane"}},
+			false,
+		},
+		{
+			"missing phone column",
+			"first_name,last_name\nJohn,Doe\n",
+			nil,
+			true,
+		},
+		{
+			"empty",
+			"",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadContacts(strings.NewReader(tt.input), ContactsCSV)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadContacts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReadContacts_VCard(t *testing.T) {
+	const input = "BEGIN:VCARD\r\n" +
+		"VERSION:4.0\r\n" +
+		"N:Doe;John;;;\r\n" +
+		"FN:John Doe\r\n" +
+		"item1.TEL;TYPE=cell:tel:+1555\r\n" +
+		"TEL;TYPE=home:+1999\r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"FN:Very Long\r\n" +
+		"  Name\r\n" +
+		"TEL:+1556\r\n" +
+		"END:VCARD\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"FN:No Phone\r\n" +
+		"END:VCARD\r\n"
+	got, err := ReadContacts(strings.NewReader(input), ContactsVCard)
+	require.NoError(t, err)
+	assert.Equal(t, []Contact{
+		{Phone: "+1555", FirstName: "John", LastName: "Doe"},
+		{Phone: "+1556", FirstName: "Very Long Name"},
+	}, got)
+}
+
+func TestReadContacts_VCardLongLines(t *testing.T) {
+	card := func(photo string) string {
+		return "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Solo\r\n" +
+			"PHOTO;ENCODING=b;TYPE=JPEG:" + photo + "\r\n" +
+			"TEL:+1555\r\nEND:VCARD\r\n"
+	}
+	photo := strings.Repeat("QUJD", 32<<10) // 128 KiB
+	folded := strings.Join(strings.SplitAfter(photo, "QUJD"), "\r\n ")
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []Contact
+		wantErr bool
+	}{
+		{"folded photo", card(folded), []Contact{{Phone: "+1555", FirstName: "Solo"}}, false},
+		{"unfolded photo", card(photo), []Contact{{Phone: "+1555", FirstName: "Solo"}}, false},
+		{"line too long", card(strings.Repeat("A", maxVCardLine)), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadContacts(strings.NewReader(tt.input), ContactsVCard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadContacts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_splitVCardValue(t *testing.T) {
+	assert.Equal(t, []string{"Doe", "John", "", "", ""}, splitVCardValue("Doe;John;;;"))
+	assert.Equal(t, []string{"a;b", "c,d"}, splitVCardValue(`a\;b;c\,d`))
+}
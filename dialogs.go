@@ -3,11 +3,10 @@ package mtpwrap
 import (
 	"context"
 	"errors"
+	"fmt"
 	"runtime/trace"
 
 	"github.com/gotd/contrib/storage"
-
-	"github.com/gotd/td/telegram/query/dialogs"
 	"github.com/gotd/td/tg"
 )
 
@@ -21,6 +20,11 @@ func (c *Client) GetChannels(ctx context.Context) ([]Entity, error) {
 	return c.GetEntities(ctx, FilterChannel())
 }
 
+// GetUsers retrieves the users known to the account.
+func (c *Client) GetUsers(ctx context.Context) ([]Entity, error) {
+	return c.GetEntities(ctx, FilterUser())
+}
+
 // GetEntities ensures that storage is populated, then iterates through storage
 // peers calling filterFn for each peer. The filterFn should return Entity and
 // true, if the peer satisfies the criteria, or nil and false, otherwise.
@@ -53,8 +57,10 @@ func (c *Client) GetEntities(ctx context.Context, filterFn FilterFunc) ([]Entity
 	return ee, nil
 }
 
-// ensureStoragePopulated ensures that the peer storage has been populated within
-// defCacheEvict duration.
+// ensureStoragePopulated ensures that the peer storage has been synchronised
+// with dialogs within defCacheEvict duration.  Only the first synchronisation
+// fetches all dialogs, the following ones fetch only the changed dialogs, see
+// SyncDialogs.
 func (c *Client) ensureStoragePopulated(ctx context.Context) error {
 	if cached, err := c.cache.Get(cacheDlgStorage); err == nil && cached.(bool) {
 		trace.Log(ctx, "cache", "hit")
@@ -63,11 +69,7 @@ func (c *Client) ensureStoragePopulated(ctx context.Context) error {
 	// populating the storage
 	trace.Log(ctx, "cache", "miss")
 
-	dlgIter := dialogs.NewQueryBuilder(c.cl.API()).
-		GetDialogs().
-		BatchSize(defBatchSize).
-		Iter()
-	if err := storage.CollectPeers(c.peerStrg).Dialogs(ctx, dlgIter); err != nil {
+	if err := c.SyncDialogs(ctx); err != nil {
 		return err
 	}
 	if err := c.cache.SetWithExpire(cacheDlgStorage, true, defCacheEvict); err != nil {
@@ -77,16 +79,18 @@ func (c *Client) ensureStoragePopulated(ctx context.Context) error {
 	return nil
 }
 
-// CreateChat creates a Chat (not a Mega- or Gigagroup).
+// CreateChat creates a Chat (not a Mega- or Gigagroup), and returns the
+// created chat.
 //
 // Example
 //
-//	 if err := cl.CreateChat(ctx, "mtproto-test",123455678, 312849128); err != nil {
-//			return err
-//		}
-func (c *Client) CreateChat(ctx context.Context, title string, userIDs ...int64) error {
+//	chat, err := cl.CreateChat(ctx, "mtproto-test", 123455678, 312849128)
+//	if err != nil {
+//		return err
+//	}
+func (c *Client) CreateChat(ctx context.Context, title string, userIDs ...int64) (Entity, error) {
 	if len(userIDs) == 0 {
-		return errors.New("at least one user is required")
+		return nil, errors.New("at least one user is required")
 	}
 
 	var others = make([]tg.InputUserClass, len(userIDs))
@@ -96,17 +100,53 @@ func (c *Client) CreateChat(ctx context.Context, title string, userIDs ...int64)
 
 	var users = append([]tg.InputUserClass{&tg.InputUserSelf{}}, others...)
 
-	var resp tg.Updates
-	if err := c.cl.Invoke(ctx,
-		&tg.MessagesCreateChatRequest{
-			Users: users,
-			Title: title,
-		},
-		&resp,
-	); err != nil {
-		return err
+	resp, err := c.api().MessagesCreateChat(ctx, &tg.MessagesCreateChatRequest{
+		Users: users,
+		Title: title,
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return c.entityFromUpdates(ctx, resp.Updates)
+}
+
+// entityFromUpdates returns the chat or channel from the updates, that are
+// returned by the chat creation or modification calls, and adds it to the peer
+// storage.  If there are several chats in the updates (i.e. when the chat is
+// migrated), the channel is preferred.
+func (c *Client) entityFromUpdates(ctx context.Context, upd tg.UpdatesClass) (Entity, error) {
+	var chats tg.ChatClassArray
+	switch u := upd.(type) {
+	case *tg.Updates:
+		chats = u.Chats
+	case *tg.UpdatesCombined:
+		chats = u.Chats
+	default:
+		return nil, fmt.Errorf("unexpected updates type: %T", upd)
+	}
+
+	var ent Entity
+	for _, chat := range chats {
+		switch ch := chat.(type) {
+		case *tg.Channel:
+			ent = ch
+		case *tg.Chat:
+			if ent == nil {
+				ent = ch
+			}
+		}
+	}
+	if ent == nil {
+		return nil, storage.ErrPeerNotFound
+	}
+
+	var peer storage.Peer
+	if peer.FromChat(ent.(tg.ChatClass)) {
+		if err := c.peerStrg.Add(ctx, peer); err != nil {
+			return nil, err
+		}
+	}
+	return ent, nil
 }
 
 func (c *Client) FindChat(ctx context.Context, id int64) (*tg.Chat, error) {
@@ -24,6 +24,16 @@ func FilterChannel() FilterFunc {
 	}
 }
 
+// FilterUser returns users, wrapped into UserEntity.
+func FilterUser() FilterFunc {
+	return func(peer storage.Peer) (Entity, bool) {
+		if peer.User != nil {
+			return UserEntity{peer.User}, true
+		}
+		return nil, false
+	}
+}
+
 func FilterPeer(id int64) FilterFunc {
 	return func(p storage.Peer) (ent Entity, ok bool) {
 		if p.Channel != nil && p.Channel.ID == id {
@@ -46,3 +56,13 @@ func FilterAnd(f1 FilterFunc, f2 FilterFunc) FilterFunc {
 		return nil, false
 	}
 }
+
+// FilterForum returns supergroups with forum topics enabled.
+func FilterForum() FilterFunc {
+	return func(peer storage.Peer) (Entity, bool) {
+		if peer.Channel != nil && peer.Channel.Forum {
+			return peer.Channel, true
+		}
+		return nil, false
+	}
+}
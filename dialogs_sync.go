@@ -0,0 +1,223 @@
+package mtpwrap
+
+import (
+	"context"
+	"fmt"
+	"runtime/trace"
+	"sync"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/telegram/query/hasher"
+	"github.com/gotd/td/tg"
+)
+
+// dialogSync is the state of the dialog synchronisation.  Dialogs are sorted
+// by the date of the top message, so once we have seen all dialogs, it's
+// enough to fetch the dialogs that have newer messages than the newest one
+// we've seen.  The changes of the peers that don't produce messages (i.e.
+// user renames) arrive with updates.
+type dialogSync struct {
+	mu      sync.Mutex // serialises synchronisations
+	synced  bool       // full synchronisation was done
+	hash    int64      // hash of the first page of dialogs
+	topDate int        // date of the newest top message seen
+}
+
+// SyncDialogs fetches the dialogs, that have changed since the last
+// synchronisation, and adds their peers to the peer storage.  The first call
+// fetches all dialogs.
+func (c *Client) SyncDialogs(ctx context.Context) error {
+	return c.syncDialogs(ctx, false)
+}
+
+// RefreshDialogs fetches all dialogs, and adds their peers to the peer
+// storage, regardless of the synchronisation state.
+func (c *Client) RefreshDialogs(ctx context.Context) error {
+	if err := c.syncDialogs(ctx, true); err != nil {
+		return err
+	}
+	return c.cache.SetWithExpire(cacheDlgStorage, true, defCacheEvict)
+}
+
+func (c *Client) syncDialogs(ctx context.Context, full bool) error {
+	ctx, task := trace.NewTask(ctx, "syncDialogs")
+	defer task.End()
+
+	ds := &c.dlgSync
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	full = full || !ds.synced
+	trace.Logf(ctx, "sync", "full=%v", full)
+
+	req := &tg.MessagesGetDialogsRequest{
+		OffsetPeer: &tg.InputPeerEmpty{},
+		Limit:      defBatchSize,
+	}
+	if !full {
+		req.Hash = ds.hash
+	}
+	var (
+		hash    = ds.hash
+		topDate = ds.topDate
+		total   int
+	)
+	for first := true; ; first = false {
+		resp, err := c.api().MessagesGetDialogs(ctx, req)
+		if err != nil {
+			return err
+		}
+		md, ok := resp.AsModified()
+		if !ok {
+			trace.Log(ctx, "sync", "not modified")
+			break
+		}
+		if err := c.addPeers(ctx, md.GetUsers(), md.GetChats()); err != nil {
+			return err
+		}
+		page := newDialogPage(md)
+		total += len(md.GetDialogs())
+		if first {
+			hash = page.hash
+		}
+		if page.topDate > topDate {
+			topDate = page.topDate
+		}
+
+		if _, complete := md.(*tg.MessagesDialogs); complete || len(md.GetDialogs()) < req.Limit {
+			break
+		}
+		if !full && page.oldestDate <= ds.topDate {
+			// the rest of dialogs haven't changed.
+			break
+		}
+		if page.next == nil {
+			return fmt.Errorf("dialogs: no known peer to continue from after %d dialogs", total)
+		}
+		req.Hash = 0
+		req.OffsetDate = page.next.date
+		req.OffsetID = page.next.msgID
+		req.OffsetPeer = page.next.peer
+	}
+	Log.Debugf("dialogs synchronised: full=%v, fetched=%d", full, total)
+
+	ds.synced = true
+	ds.hash = hash
+	ds.topDate = topDate
+	return nil
+}
+
+// addPeers adds users and chats to the peer storage.
+func (c *Client) addPeers(ctx context.Context, users []tg.UserClass, chats []tg.ChatClass) error {
+	for _, u := range users {
+		var p storage.Peer
+		if !p.FromUser(u) {
+			continue
+		}
+		if err := c.peerStrg.Add(ctx, p); err != nil {
+			return err
+		}
+	}
+	for _, ch := range chats {
+		var p storage.Peer
+		if !p.FromChat(ch) {
+			continue
+		}
+		if err := c.peerStrg.Add(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dialogPage is the summary of the page of dialogs.
+type dialogPage struct {
+	hash       int64
+	topDate    int // the newest top message date
+	oldestDate int // the oldest top message date of unpinned dialogs
+	next       *dialogOffset
+}
+
+// dialogOffset is the offset of the next page of dialogs.
+type dialogOffset struct {
+	date  int
+	msgID int
+	peer  tg.InputPeerClass
+}
+
+type msgKey struct {
+	peer dialogs.DialogKey
+	id   int
+}
+
+func newDialogPage(md tg.ModifiedMessagesDialogs) dialogPage {
+	dates := make(map[msgKey]int, len(md.GetMessages()))
+	for _, m := range md.GetMessages() {
+		msg, ok := m.AsNotEmpty()
+		if !ok {
+			continue
+		}
+		var k msgKey
+		if err := k.peer.FromPeer(msg.GetPeerID()); err != nil {
+			continue
+		}
+		k.id = msg.GetID()
+		dates[k] = msg.GetDate()
+	}
+
+	var (
+		pg       dialogPage
+		h        hasher.Hasher
+		dlgs     = md.GetDialogs()
+		dlgDates = make([]int, len(dlgs))
+	)
+	for i, d := range dlgs {
+		var k msgKey
+		if err := k.peer.FromPeer(d.GetPeer()); err != nil {
+			continue
+		}
+		k.id = d.GetTopMessage()
+		date := dates[k]
+		dlgDates[i] = date
+
+		h.Update64(uint64(k.peer.ID))
+		h.Update(uint32(k.id))
+		h.Update(uint32(date))
+
+		if date > pg.topDate {
+			pg.topDate = date
+		}
+		if !d.GetPinned() && (pg.oldestDate == 0 || date < pg.oldestDate) {
+			pg.oldestDate = date
+		}
+	}
+	pg.hash = h.Sum()
+
+	// the next page starts after the last dialog, which peer is known, the
+	// dialogs following it are fetched again.
+	for i := len(dlgs) - 1; i >= 0 && pg.next == nil; i-- {
+		if ip, ok := inputPeer(dlgs[i].GetPeer(), md.GetUsers(), md.GetChats()); ok {
+			pg.next = &dialogOffset{date: dlgDates[i], msgID: dlgs[i].GetTopMessage(), peer: ip}
+		}
+	}
+	return pg
+}
+
+// inputPeer returns the input peer for the peer, looking up the access hash
+// in users and chats.
+func inputPeer(p tg.PeerClass, users []tg.UserClass, chats []tg.ChatClass) (tg.InputPeerClass, bool) {
+	switch v := p.(type) {
+	case *tg.PeerUser:
+		if u, ok := tg.UserClassArray(users).UserToMap()[v.UserID]; ok {
+			return u.AsInputPeer(), true
+		}
+	case *tg.PeerChat:
+		return &tg.InputPeerChat{ChatID: v.ChatID}, true
+	case *tg.PeerChannel:
+		if ch, ok := tg.ChatClassArray(chats).ChannelToMap()[v.ChannelID]; ok {
+			return ch.AsInputPeer(), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,247 @@
+package mtpwrap
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newDialogPage(t *testing.T) {
+	var (
+		user    = &tg.User{ID: 1, AccessHash: 10}
+		channel = &tg.Channel{ID: 2, AccessHash: 20}
+		pinned  = &tg.Dialog{Pinned: true, Peer: &tg.PeerChat{ChatID: 3}, TopMessage: 5}
+	)
+	// flags are set by the decoder for the real responses.
+	user.SetFlags()
+	channel.SetFlags()
+	pinned.SetFlags()
+	page := &tg.MessagesDialogsSlice{
+		Dialogs: []tg.DialogClass{
+			pinned,
+			&tg.Dialog{Peer: &tg.PeerChannel{ChannelID: 2}, TopMessage: 100},
+			&tg.Dialog{Peer: &tg.PeerUser{UserID: 1}, TopMessage: 7},
+		},
+		Messages: []tg.MessageClass{
+			&tg.Message{ID: 5, PeerID: &tg.PeerChat{ChatID: 3}, Date: 10},
+			&tg.Message{ID: 100, PeerID: &tg.PeerChannel{ChannelID: 2}, Date: 300},
+			&tg.Message{ID: 7, PeerID: &tg.PeerUser{UserID: 1}, Date: 200},
+			// same message id in another peer must not be confused.
+			&tg.Message{ID: 7, PeerID: &tg.PeerChannel{ChannelID: 2}, Date: 1},
+		},
+		Users: []tg.UserClass{user},
+		Chats: []tg.ChatClass{channel, &tg.Chat{ID: 3}},
+	}
+
+	got := newDialogPage(page)
+	assert.Equal(t, 300, got.topDate)
+	assert.Equal(t, 200, got.oldestDate, "pinned dialogs must be ignored")
+	require.NotNil(t, got.next)
+	assert.Equal(t, dialogOffset{date: 200, msgID: 7, peer: &tg.InputPeerUser{UserID: 1, AccessHash: 10}}, *got.next)
+	assert.NotZero(t, got.hash)
+
+	// hash changes, when the top message changes.
+	page.Dialogs[2].(*tg.Dialog).TopMessage = 8
+	page.Messages = append(page.Messages, &tg.Message{ID: 8, PeerID: &tg.PeerUser{UserID: 1}, Date: 400})
+	changed := newDialogPage(page)
+	assert.NotEqual(t, got.hash, changed.hash)
+	assert.Equal(t, 400, changed.topDate)
+}
+
+func Test_inputPeer(t *testing.T) {
+	var (
+		users = []tg.UserClass{&tg.User{ID: 1, AccessHash: 10}}
+		chats = []tg.ChatClass{&tg.Channel{ID: 2, AccessHash: 20}}
+	)
+	for _, u := range users {
+		u.(*tg.User).SetFlags()
+	}
+	for _, ch := range chats {
+		ch.(*tg.Channel).SetFlags()
+	}
+	tests := []struct {
+		name   string
+		peer   tg.PeerClass
+		want   tg.InputPeerClass
+		wantOk bool
+	}{
+		{"user", &tg.PeerUser{UserID: 1}, &tg.InputPeerUser{UserID: 1, AccessHash: 10}, true},
+		{"chat", &tg.PeerChat{ChatID: 3}, &tg.InputPeerChat{ChatID: 3}, true},
+		{"channel", &tg.PeerChannel{ChannelID: 2}, &tg.InputPeerChannel{ChannelID: 2, AccessHash: 20}, true},
+		{"unknown user", &tg.PeerUser{UserID: 42}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := inputPeer(tt.peer, users, chats)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// fakeDialogs is the fake server of the dialogs of users, sorted by the date
+// of the top message, which is the message ID.
+type fakeDialogs struct {
+	users  []*tg.User
+	top    map[int64]int // user ID to the top message ID
+	lastID int
+
+	hidden map[int64]bool // users, that are not returned with the dialogs
+
+	reqs    []tg.MessagesGetDialogsRequest
+	fetched map[int64]bool // users returned since the last reset
+}
+
+func newFakeDialogs(n int) *fakeDialogs {
+	f := &fakeDialogs{top: make(map[int64]int), hidden: make(map[int64]bool), fetched: make(map[int64]bool)}
+	for i := 1; i <= n; i++ {
+		f.users = append(f.users, &tg.User{ID: int64(i), AccessHash: int64(i * 10), FirstName: fmt.Sprintf("user%d", i)})
+		f.lastID++
+		f.top[int64(i)] = f.lastID
+	}
+	return f
+}
+
+// bump sends the new message to the dialog with the user, and renames them.
+func (f *fakeDialogs) bump(id int64, name string) {
+	f.lastID++
+	f.top[id] = f.lastID
+	f.users[id-1].FirstName = name
+}
+
+// reset returns the requests and the fetched users since the last reset,
+// and resets them.
+func (f *fakeDialogs) reset() ([]tg.MessagesGetDialogsRequest, map[int64]bool) {
+	reqs, fetched := f.reqs, f.fetched
+	f.reqs, f.fetched = nil, make(map[int64]bool)
+	return reqs, fetched
+}
+
+// page returns the page of dialogs, older than offsetDate, if it's not zero.
+func (f *fakeDialogs) page(offsetDate, limit int) *tg.MessagesDialogsSlice {
+	sorted := slices.Clone(f.users)
+	slices.SortFunc(sorted, func(a, b *tg.User) int { return f.top[b.ID] - f.top[a.ID] })
+	resp := &tg.MessagesDialogsSlice{Count: len(f.users)}
+	for _, u := range sorted {
+		top := f.top[u.ID]
+		if offsetDate != 0 && top >= offsetDate {
+			continue
+		}
+		if len(resp.Dialogs) == limit {
+			break
+		}
+		peer := &tg.PeerUser{UserID: u.ID}
+		resp.Dialogs = append(resp.Dialogs, &tg.Dialog{Peer: peer, TopMessage: top})
+		resp.Messages = append(resp.Messages, &tg.Message{ID: top, PeerID: peer, Date: top})
+		if !f.hidden[u.ID] {
+			resp.Users = append(resp.Users, u)
+		}
+	}
+	return resp
+}
+
+func (f *fakeDialogs) api(_ context.Context, r bin.Encoder) (bin.Encoder, error) {
+	req, ok := r.(*tg.MessagesGetDialogsRequest)
+	if !ok {
+		return nil, fmt.Errorf("unexpected request: %T", r)
+	}
+	f.reqs = append(f.reqs, *req)
+	resp := f.page(req.OffsetDate, req.Limit)
+	if req.Hash != 0 && req.OffsetDate == 0 && req.Hash == newDialogPage(resp).hash {
+		return &tg.MessagesDialogsNotModified{Count: resp.Count}, nil
+	}
+	for _, u := range resp.Users {
+		f.fetched[u.(*tg.User).ID] = true
+	}
+	return resp, nil
+}
+
+func TestClient_syncDialogs(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDialogs(2*defBatchSize + 50)
+	c := newFakeAPIClient(t, f.api)
+	firstName := func(id int64) string {
+		t.Helper()
+		p, err := c.peerStrg.Find(ctx, storage.PeerKey{Kind: dialogs.User, ID: id})
+		require.NoError(t, err)
+		return p.User.FirstName
+	}
+
+	// first synchronisation is full.
+	require.NoError(t, c.SyncDialogs(ctx))
+	reqs, fetched := f.reset()
+	assert.Len(t, reqs, 3)
+	assert.Zero(t, reqs[0].Hash)
+	assert.Len(t, fetched, len(f.users))
+	assert.Equal(t, "user1", firstName(1))
+
+	// nothing changed, the hash of the first page is reused.
+	require.NoError(t, c.SyncDialogs(ctx))
+	reqs, fetched = f.reset()
+	require.Len(t, reqs, 1)
+	assert.NotZero(t, reqs[0].Hash)
+	assert.Empty(t, fetched)
+
+	// few dialogs changed, only the first page is fetched.
+	for _, id := range []int64{1, 2, 3} {
+		f.bump(id, fmt.Sprintf("renamed%d", id))
+	}
+	require.NoError(t, c.SyncDialogs(ctx))
+	reqs, fetched = f.reset()
+	assert.Len(t, reqs, 1)
+	assert.Len(t, fetched, defBatchSize)
+	assert.Equal(t, "renamed1", firstName(1))
+	assert.Equal(t, "renamed3", firstName(3))
+
+	// more than a page changed, fetching stops at the first page with the
+	// dialogs, seen before.
+	for id := int64(1); id <= defBatchSize+5; id++ {
+		f.bump(id, fmt.Sprintf("again%d", id))
+	}
+	require.NoError(t, c.SyncDialogs(ctx))
+	reqs, fetched = f.reset()
+	require.Len(t, reqs, 2)
+	assert.Len(t, fetched, 2*defBatchSize)
+	assert.False(t, fetched[defBatchSize+6], "the oldest dialogs must not be fetched")
+	assert.NotZero(t, reqs[1].OffsetDate)
+	assert.Zero(t, reqs[1].Hash, "hash is only valid for the first page")
+	assert.Equal(t, fmt.Sprintf("again%d", defBatchSize+5), firstName(defBatchSize+5))
+
+	// refresh forces the full synchronisation.
+	require.NoError(t, c.RefreshDialogs(ctx))
+	reqs, fetched = f.reset()
+	assert.Len(t, reqs, 3)
+	assert.Zero(t, reqs[0].Hash)
+	assert.Len(t, fetched, len(f.users))
+}
+
+func TestClient_syncDialogsUnknownPeer(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeDialogs(2*defBatchSize + 50)
+	// the last dialog of the first page.
+	lastID := int64(len(f.users) - defBatchSize + 1)
+	f.hidden[lastID] = true
+	c := newFakeAPIClient(t, f.api)
+
+	require.NoError(t, c.RefreshDialogs(ctx))
+	reqs, fetched := f.reset()
+	require.Len(t, reqs, 3)
+	assert.Equal(t, f.top[lastID+1], reqs[1].OffsetDate, "must continue from the last known peer")
+	assert.Len(t, fetched, len(f.users)-1, "all dialogs must be fetched")
+
+	// no known peers on the page.
+	for _, u := range f.users {
+		f.hidden[u.ID] = true
+	}
+	assert.Error(t, c.RefreshDialogs(ctx))
+	reqs, _ = f.reset()
+	assert.Len(t, reqs, 1)
+}
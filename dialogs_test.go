@@ -0,0 +1,71 @@
+package mtpwrap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_entityFromUpdates(t *testing.T) {
+	var (
+		testChat    = &tg.Chat{ID: 1, Title: "chat"}
+		testChannel = &tg.Channel{ID: 2, Title: "channel", Megagroup: true}
+	)
+	tests := []struct {
+		name    string
+		upd     tg.UpdatesClass
+		want    Entity
+		wantErr bool
+	}{
+		{
+			"chat",
+			&tg.Updates{Chats: []tg.ChatClass{testChat}},
+			testChat,
+			false,
+		},
+		{
+			"migrated chat prefers channel",
+			&tg.Updates{Chats: []tg.ChatClass{testChat, testChannel}},
+			testChannel,
+			false,
+		},
+		{
+			"combined updates",
+			&tg.UpdatesCombined{Chats: []tg.ChatClass{testChannel}},
+			testChannel,
+			false,
+		},
+		{
+			"no chats",
+			&tg.Updates{},
+			nil,
+			true,
+		},
+		{
+			"unexpected updates",
+			&tg.UpdatesTooLong{},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{peerStrg: NewMemStorage()}
+			got, err := c.entityFromUpdates(context.Background(), tt.upd)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.entityFromUpdates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			if tt.want != nil {
+				var peer storage.Peer
+				peer.FromChat(tt.want.(tg.ChatClass))
+				_, err := c.peerStrg.Find(context.Background(), storage.KeyFromPeer(peer))
+				assert.NoError(t, err, "entity must be added to the peer storage")
+			}
+		})
+	}
+}
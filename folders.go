@@ -0,0 +1,218 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/tg"
+)
+
+// ErrFolderNotFound is returned if there's no folder with the given title.
+var ErrFolderNotFound = errors.New("folder not found")
+
+// minFolderID is the minimum ID of the user folder, lower IDs are reserved.
+const minFolderID = 2
+
+// Folders returns the chat folders (dialog filters) of the account, in the
+// order they are shown.  The result contains *tg.DialogFilter and
+// *tg.DialogFilterChatlist (shared folders).
+func (c *Client) Folders(ctx context.Context) ([]tg.DialogFilterClass, error) {
+	resp, err := c.api().MessagesGetDialogFilters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ff []tg.DialogFilterClass
+	for _, f := range resp.Filters {
+		switch f.(type) {
+		case *tg.DialogFilter, *tg.DialogFilterChatlist:
+			ff = append(ff, f)
+		}
+	}
+	return ff, nil
+}
+
+// FindFolder returns the folder with the title, ignoring case.
+func (c *Client) FindFolder(ctx context.Context, title string) (tg.DialogFilterClass, error) {
+	ff, err := c.Folders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t := NormalizeTitle(title)
+	for _, f := range ff {
+		if NormalizeTitle(folderTitle(f)) == t {
+			return f, nil
+		}
+	}
+	return nil, ErrFolderNotFound
+}
+
+// CreateFolder creates the folder f, assigning it a new ID, which is
+// returned.
+func (c *Client) CreateFolder(ctx context.Context, f *tg.DialogFilter) (int, error) {
+	if f.Title == "" {
+		return 0, errors.New("title is required")
+	}
+	ff, err := c.Folders(ctx)
+	if err != nil {
+		return 0, err
+	}
+	f.ID = nextFolderID(ff)
+	if err := c.UpdateFolder(ctx, f); err != nil {
+		return 0, err
+	}
+	return f.ID, nil
+}
+
+// nextFolderID returns the ID for the new folder.
+func nextFolderID(ff []tg.DialogFilterClass) int {
+	id := minFolderID
+	for _, f := range ff {
+		if fid := folderID(f); fid >= id {
+			id = fid + 1
+		}
+	}
+	return id
+}
+
+// UpdateFolder replaces the folder with the same ID with f.
+func (c *Client) UpdateFolder(ctx context.Context, f tg.DialogFilterClass) error {
+	req := &tg.MessagesUpdateDialogFilterRequest{ID: folderID(f)}
+	req.SetFilter(f)
+	_, err := c.api().MessagesUpdateDialogFilter(ctx, req)
+	return err
+}
+
+// DeleteFolder deletes the folder with the ID.  Chats in the folder are not
+// affected.
+func (c *Client) DeleteFolder(ctx context.Context, id int) error {
+	_, err := c.api().MessagesUpdateDialogFilter(ctx, &tg.MessagesUpdateDialogFilterRequest{ID: id})
+	return err
+}
+
+// ReorderFolders sets the order of the folders, ids must contain the IDs of
+// all folders.
+func (c *Client) ReorderFolders(ctx context.Context, ids []int) error {
+	_, err := c.api().MessagesUpdateDialogFiltersOrder(ctx, ids)
+	return err
+}
+
+// FolderFilter returns the filter function, that selects the peers of the
+// folder with the title.  See FilterFolder.
+func (c *Client) FolderFilter(ctx context.Context, title string) (FilterFunc, error) {
+	f, err := c.FindFolder(ctx, title)
+	if err != nil {
+		return nil, err
+	}
+	return FilterFolder(f), nil
+}
+
+// FilterFolder returns the filter function, that selects the peers matching
+// the folder include and exclude rules.  The rules that depend on the dialog
+// state (muted, read, archived) are not applied, and the "Saved Messages"
+// chat is never matched.
+func FilterFolder(f tg.DialogFilterClass) FilterFunc {
+	var (
+		include map[dialogs.DialogKey]bool
+		exclude map[dialogs.DialogKey]bool
+		df, _   = f.(*tg.DialogFilter)
+	)
+	if v, ok := f.(folder); ok {
+		include = peerKeys(v.GetIncludePeers(), v.GetPinnedPeers())
+	}
+	if df != nil {
+		exclude = peerKeys(df.ExcludePeers)
+	}
+	return func(peer storage.Peer) (Entity, bool) {
+		ent, ok := peerEntity(peer)
+		if !ok || isSelf(peer) {
+			return nil, false
+		}
+		k := peer.Key
+		k.AccessHash = 0
+		if include[k] {
+			return ent, true
+		}
+		if exclude[k] || df == nil {
+			return nil, false
+		}
+		if folderCategory(df, peer) {
+			return ent, true
+		}
+		return nil, false
+	}
+}
+
+// folderCategory returns true, if the peer belongs to one of the peer types
+// included in the folder.
+func folderCategory(f *tg.DialogFilter, peer storage.Peer) bool {
+	switch {
+	case peer.User != nil:
+		u := peer.User
+		if u.Self {
+			return false // Saved Messages
+		}
+		switch {
+		case u.Bot:
+			return f.Bots
+		case u.Contact || u.MutualContact:
+			return f.Contacts
+		default:
+			return f.NonContacts
+		}
+	case peer.Chat != nil:
+		return f.Groups
+	case peer.Channel != nil:
+		if peer.Channel.Broadcast {
+			return f.Broadcasts
+		}
+		return f.Groups
+	}
+	return false
+}
+
+// isSelf returns true, if the peer is the current user, i.e. the "Saved
+// Messages" chat.
+func isSelf(peer storage.Peer) bool {
+	return peer.User != nil && peer.User.Self
+}
+
+// peerKeys returns the set of dialog keys of the input peers, without access
+// hashes.
+func peerKeys(lists ...[]tg.InputPeerClass) map[dialogs.DialogKey]bool {
+	keys := make(map[dialogs.DialogKey]bool)
+	for _, ipp := range lists {
+		for _, ip := range ipp {
+			var k dialogs.DialogKey
+			if err := k.FromInputPeer(ip); err != nil {
+				continue
+			}
+			k.AccessHash = 0
+			keys[k] = true
+		}
+	}
+	return keys
+}
+
+// folder is implemented by the user folders and the shared folders.
+type folder interface {
+	GetID() int
+	GetTitle() string
+	GetPinnedPeers() []tg.InputPeerClass
+	GetIncludePeers() []tg.InputPeerClass
+}
+
+func folderID(f tg.DialogFilterClass) int {
+	if v, ok := f.(folder); ok {
+		return v.GetID()
+	}
+	return 0
+}
+
+func folderTitle(f tg.DialogFilterClass) string {
+	if v, ok := f.(folder); ok {
+		return v.GetTitle()
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package mtpwrap
+
+import (
+	"testing"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterFolder(t *testing.T) {
+	var (
+		contact  = &tg.User{ID: 1, Contact: true}
+		stranger = &tg.User{ID: 2}
+		bot      = &tg.User{ID: 3, Bot: true}
+		chat     = &tg.Chat{ID: 4}
+		group    = &tg.Channel{ID: 5, Megagroup: true}
+		channel  = &tg.Channel{ID: 6, Broadcast: true}
+		channel2 = &tg.Channel{ID: 7, Broadcast: true}
+		self     = &tg.User{ID: 8, Self: true, Contact: true}
+		selfNC   = &tg.User{ID: 9, Self: true}
+		mkPeer   = func(v any) storage.Peer {
+			var p storage.Peer
+			switch e := v.(type) {
+			case tg.UserClass:
+				require.True(t, p.FromUser(e))
+			case tg.ChatClass:
+				require.True(t, p.FromChat(e))
+			}
+			return p
+		}
+		all = []any{contact, stranger, bot, chat, group, channel, channel2, self, selfNC}
+	)
+	tests := []struct {
+		name   string
+		folder tg.DialogFilterClass
+		want   []int64
+	}{
+		{
+			"contacts and groups",
+			&tg.DialogFilter{Contacts: true, Groups: true},
+			[]int64{1, 4, 5},
+		},
+		{
+			"non-contacts and bots",
+			&tg.DialogFilter{NonContacts: true, Bots: true},
+			[]int64{2, 3},
+		},
+		{
+			"channels with exclusion",
+			&tg.DialogFilter{Broadcasts: true, ExcludePeers: []tg.InputPeerClass{&tg.InputPeerChannel{ChannelID: 6, AccessHash: 99}}},
+			[]int64{7},
+		},
+		{
+			"included and pinned peers",
+			&tg.DialogFilter{
+				IncludePeers: []tg.InputPeerClass{&tg.InputPeerUser{UserID: 2}},
+				PinnedPeers:  []tg.InputPeerClass{&tg.InputPeerChat{ChatID: 4}},
+			},
+			[]int64{2, 4},
+		},
+		{
+			"include wins over exclude",
+			&tg.DialogFilter{
+				IncludePeers: []tg.InputPeerClass{&tg.InputPeerUser{UserID: 1}},
+				ExcludePeers: []tg.InputPeerClass{&tg.InputPeerUser{UserID: 1}},
+			},
+			[]int64{1},
+		},
+		{
+			"shared folder",
+			&tg.DialogFilterChatlist{IncludePeers: []tg.InputPeerClass{&tg.InputPeerChannel{ChannelID: 5}}},
+			[]int64{5},
+		},
+		{
+			"saved messages are never matched",
+			&tg.DialogFilter{
+				Contacts:     true,
+				NonContacts:  true,
+				IncludePeers: []tg.InputPeerClass{&tg.InputPeerUser{UserID: 9}},
+			},
+			[]int64{1, 2},
+		},
+		{
+			"default folder",
+			&tg.DialogFilterDefault{},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := FilterFolder(tt.folder)
+			var got []int64
+			for _, v := range all {
+				if ent, ok := fn(mkPeer(v)); ok {
+					got = append(got, ent.GetID())
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_nextFolderID(t *testing.T) {
+	assert.Equal(t, 2, nextFolderID(nil))
+	assert.Equal(t, 6, nextFolderID([]tg.DialogFilterClass{
+		&tg.DialogFilter{ID: 5},
+		&tg.DialogFilterChatlist{ID: 3},
+		&tg.DialogFilterDefault{},
+	}))
+}
@@ -4,6 +4,7 @@ go 1.22
 
 require (
 	github.com/bluele/gcache v0.0.2
+	github.com/cenkalti/backoff/v4 v4.3.0
 	github.com/fatih/color v1.16.0
 	github.com/gotd/contrib v0.20.0
 	github.com/gotd/td v0.101.0
@@ -12,11 +13,12 @@ require (
 	github.com/rusq/encio v0.1.0
 	github.com/stretchr/testify v1.9.0
 	go.uber.org/zap v1.27.0
+	golang.org/x/net v0.24.0
 	golang.org/x/term v0.19.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/cenkalti/backoff/v4 v4.3.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/denisbrodbeck/machineid v1.0.1 // indirect
 	github.com/go-faster/errors v0.7.1 // indirect
@@ -34,10 +36,8 @@ require (
 	go.uber.org/atomic v1.11.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/crypto v0.22.0 // indirect
-	golang.org/x/net v0.24.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/sys v0.19.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 	nhooyr.io/websocket v1.8.11 // indirect
 	rsc.io/qr v0.2.0 // indirect
 )
@@ -0,0 +1,160 @@
+package mtpwrap
+
+import (
+	"context"
+	"fmt"
+	"runtime/trace"
+	"time"
+
+	"github.com/gotd/td/tg"
+
+	"github.com/rusq/mtpwrap/archive"
+)
+
+// HistoryOptions are the parameters of DeleteHistory.
+type HistoryOptions struct {
+	// Revoke if set, deletes the history for all participants, otherwise
+	// only for the current user.  Channels and supergroups history can only
+	// be deleted for everyone by the creator, otherwise it is cleared for the
+	// current user.
+	Revoke bool
+	// MaxID if not zero, only messages with IDs up to MaxID are deleted.
+	MaxID int
+	// MinDate and MaxDate if not zero, limit the date of the deleted messages
+	// in private and basic chats.
+	MinDate time.Time
+	MaxDate time.Time
+	// JustClear if set, the dialog remains in the dialog list, otherwise it
+	// is removed.  Private and basic chats only.
+	JustClear bool
+}
+
+// match reports whether the archived message is within the bounds of the
+// options.
+func (o HistoryOptions) match(m archive.Message) bool {
+	return (o.MaxID == 0 || m.ID <= o.MaxID) &&
+		(o.MinDate.IsZero() || m.Date.After(o.MinDate)) &&
+		(o.MaxDate.IsZero() || m.Date.Before(o.MaxDate))
+}
+
+// DeleteHistory deletes the message history of the dialog dlg.  It returns
+// the number of deleted messages, if known (it's not reported for channels).
+// The deleted messages are removed from the archive, if it's set.
+func (c *Client) DeleteHistory(ctx context.Context, dlg Entity, opts HistoryOptions) (int, error) {
+	ctx, task := trace.NewTask(ctx, "DeleteHistory")
+	defer task.End()
+
+	// clearing cache.
+	c.cache.Remove(cacheKey(dlg.GetID()))
+
+	if ch, ok := dlg.(*tg.Channel); ok {
+		if !opts.MinDate.IsZero() || !opts.MaxDate.IsZero() {
+			return 0, fmt.Errorf("date bounds: %w", ErrChannel)
+		}
+		_, err := c.api().ChannelsDeleteHistory(ctx, &tg.ChannelsDeleteHistoryRequest{
+			ForEveryone: opts.Revoke,
+			Channel:     ch.AsInput(),
+			MaxID:       opts.MaxID,
+		})
+		if err != nil {
+			return 0, err
+		}
+		return 0, c.unarchiveHistory(dlg, opts.match)
+	}
+
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return 0, err
+	}
+	req := &tg.MessagesDeleteHistoryRequest{
+		JustClear: opts.JustClear,
+		Revoke:    opts.Revoke,
+		Peer:      ip,
+		MaxID:     opts.MaxID,
+		MinDate:   unixDate(opts.MinDate),
+		MaxDate:   unixDate(opts.MaxDate),
+	}
+	n, err := affectedHistory(ctx, func(ctx context.Context) (*tg.MessagesAffectedHistory, error) {
+		return c.api().MessagesDeleteHistory(ctx, req)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, c.unarchiveHistory(dlg, opts.match)
+}
+
+// DeleteParticipantHistory deletes all messages of the participant in the
+// supergroup dlg.  It requires the admin rights to delete messages.  It
+// returns the number of deleted messages.  The deleted messages are removed
+// from the archive, if it's set.
+func (c *Client) DeleteParticipantHistory(ctx context.Context, dlg Entity, participant tg.InputPeerClass) (int, error) {
+	ctx, task := trace.NewTask(ctx, "DeleteParticipantHistory")
+	defer task.End()
+
+	ch, err := asInputChannel(dlg)
+	if err != nil {
+		return 0, err
+	}
+	c.cache.Remove(cacheKey(dlg.GetID()))
+	n, err := affectedHistory(ctx, func(ctx context.Context) (*tg.MessagesAffectedHistory, error) {
+		return c.api().ChannelsDeleteParticipantHistory(ctx, &tg.ChannelsDeleteParticipantHistoryRequest{
+			Channel:     ch,
+			Participant: participant,
+		})
+	})
+	if err != nil || c.archive == nil {
+		return n, err
+	}
+	fromID, err := c.inputPeerID(ctx, participant)
+	if err != nil {
+		return n, fmt.Errorf("archive: %w", err)
+	}
+	return n, c.unarchiveHistory(dlg, func(m archive.Message) bool {
+		return m.FromID == fromID
+	})
+}
+
+// inputPeerID returns the ID of the user or channel ip.  The current user is
+// requested from the API.
+func (c *Client) inputPeerID(ctx context.Context, ip tg.InputPeerClass) (int64, error) {
+	switch p := ip.(type) {
+	case *tg.InputPeerUser:
+		return p.UserID, nil
+	case *tg.InputPeerUserFromMessage:
+		return p.UserID, nil
+	case *tg.InputPeerChannel:
+		return p.ChannelID, nil
+	case *tg.InputPeerChannelFromMessage:
+		return p.ChannelID, nil
+	case *tg.InputPeerSelf:
+		users, err := c.api().UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUserSelf{}})
+		if err != nil {
+			return 0, err
+		}
+		if len(users) == 0 {
+			return 0, fmt.Errorf("current user not found")
+		}
+		return users[0].GetID(), nil
+	default:
+		return 0, fmt.Errorf("unsupported input peer type: %T", ip)
+	}
+}
+
+// affectedHistory calls fn until the history is processed completely, as
+// telegram processes the history in batches, and returns the non-zero offset,
+// if there's more to process.  It returns the total number of affected
+// messages.
+func affectedHistory(ctx context.Context, fn func(context.Context) (*tg.MessagesAffectedHistory, error)) (int, error) {
+	total := 0
+	for {
+		resp, err := fn(ctx)
+		if err != nil {
+			return total, err
+		}
+		total += resp.PtsCount
+		trace.Logf(ctx, "api", "affected: %d, offset: %d", resp.PtsCount, resp.Offset)
+		if resp.Offset <= 0 {
+			return total, nil
+		}
+	}
+}
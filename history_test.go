@@ -0,0 +1,200 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rusq/mtpwrap/archive"
+)
+
+func Test_affectedHistory(t *testing.T) {
+	errTest := errors.New("test")
+	tests := []struct {
+		name      string
+		resps     []*tg.MessagesAffectedHistory
+		errAt     int // call index that fails, -1 for none
+		want      int
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			"single batch",
+			[]*tg.MessagesAffectedHistory{{PtsCount: 5}},
+			-1, 5, 1, nil,
+		},
+		{
+			"several batches",
+			[]*tg.MessagesAffectedHistory{{PtsCount: 100, Offset: 1}, {PtsCount: 100, Offset: 1}, {PtsCount: 3}},
+			-1, 203, 3, nil,
+		},
+		{
+			"error in the middle",
+			[]*tg.MessagesAffectedHistory{{PtsCount: 100, Offset: 1}, nil},
+			1, 100, 2, errTest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			got, err := affectedHistory(context.Background(), func(ctx context.Context) (*tg.MessagesAffectedHistory, error) {
+				defer func() { calls++ }()
+				if calls == tt.errAt {
+					return nil, errTest
+				}
+				return tt.resps[calls], nil
+			})
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
+
+func TestClient_DeleteHistoryChannelDates(t *testing.T) {
+	c := newTestClient(t)
+	_, err := c.DeleteHistory(context.Background(), &tg.Channel{ID: 1}, HistoryOptions{MinDate: unixTime(1)})
+	assert.ErrorIs(t, err, ErrChannel)
+}
+
+func TestClient_DeleteParticipantHistoryBasicChat(t *testing.T) {
+	c := newTestClient(t)
+	_, err := c.DeleteParticipantHistory(context.Background(), &tg.Chat{ID: 1}, &tg.InputPeerSelf{})
+	assert.ErrorIs(t, err, ErrBasicChat)
+}
+
+func TestClient_DeleteMessagesForMeChannel(t *testing.T) {
+	c := newTestClient(t)
+	_, err := c.DeleteMessagesForMe(context.Background(), &tg.Channel{ID: 1}, nil)
+	assert.ErrorIs(t, err, ErrChannel)
+}
+
+// historyAPI answers the history deletion requests, deleting n messages.
+func historyAPI(n int) fakeAPI {
+	return func(_ context.Context, req bin.Encoder) (bin.Encoder, error) {
+		switch req.(type) {
+		case *tg.MessagesDeleteHistoryRequest, *tg.ChannelsDeleteParticipantHistoryRequest:
+			return &tg.MessagesAffectedHistory{PtsCount: n}, nil
+		case *tg.ChannelsDeleteHistoryRequest:
+			return &tg.Updates{}, nil
+		case *tg.UsersGetUsersRequest:
+			return &tg.UserClassVector{Elems: []tg.UserClass{&tg.User{ID: 11, Self: true}}}, nil
+		default:
+			return nil, fmt.Errorf("unexpected request: %T", req)
+		}
+	}
+}
+
+func TestClient_DeleteHistoryArchive(t *testing.T) {
+	var (
+		base    = time.Unix(1700000000, 0)
+		chat    = &tg.Chat{ID: 5}
+		channel = &tg.Channel{ID: 5}
+	)
+	chatPeer, err := archivePeer(chat)
+	require.NoError(t, err)
+	channelPeer, err := archivePeer(channel)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		fn   func(c *Client) error
+		want map[archive.Peer][]int // remaining message IDs
+	}{
+		{
+			"chat history",
+			func(c *Client) error {
+				_, err := c.DeleteHistory(context.Background(), chat, HistoryOptions{})
+				return err
+			},
+			map[archive.Peer][]int{channelPeer: {4, 3, 2, 1}},
+		},
+		{
+			"chat history bounds",
+			func(c *Client) error {
+				_, err := c.DeleteHistory(context.Background(), chat, HistoryOptions{
+					MaxID:   3,
+					MinDate: base,
+				})
+				return err
+			},
+			map[archive.Peer][]int{chatPeer: {4, 1}, channelPeer: {4, 3, 2, 1}},
+		},
+		{
+			"channel history up to MaxID",
+			func(c *Client) error {
+				_, err := c.DeleteHistory(context.Background(), channel, HistoryOptions{MaxID: 2})
+				return err
+			},
+			map[archive.Peer][]int{chatPeer: {4, 3, 2, 1}, channelPeer: {4, 3}},
+		},
+		{
+			"participant history",
+			func(c *Client) error {
+				_, err := c.DeleteParticipantHistory(context.Background(), channel, &tg.InputPeerUser{UserID: 10})
+				return err
+			},
+			map[archive.Peer][]int{chatPeer: {4, 3, 2, 1}, channelPeer: {3, 1}},
+		},
+		{
+			"own participant history",
+			func(c *Client) error {
+				_, err := c.DeleteParticipantHistory(context.Background(), channel, &tg.InputPeerSelf{})
+				return err
+			},
+			map[archive.Peer][]int{chatPeer: {4, 3, 2, 1}, channelPeer: {4, 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := archive.Open(t.TempDir())
+			require.NoError(t, err)
+			defer a.Close()
+			for _, peer := range []archive.Peer{chatPeer, channelPeer} {
+				for id := 1; id <= 4; id++ {
+					require.NoError(t, a.Store(archive.Message{
+						Peer:   peer,
+						ID:     id,
+						FromID: int64(10 + id%2), // odd from 11, even from 10
+						Date:   base.Add(time.Duration(id-1) * time.Hour),
+					}))
+				}
+			}
+
+			c := newFakeAPIClient(t, historyAPI(4), WithArchive(a))
+			require.NoError(t, tt.fn(c))
+			for _, peer := range []archive.Peer{chatPeer, channelPeer} {
+				got, err := a.Search(archive.Query{Peer: peer})
+				require.NoError(t, err)
+				var ids []int
+				for _, m := range got {
+					ids = append(ids, m.ID)
+				}
+				assert.Equal(t, tt.want[peer], ids, peer.Type)
+			}
+		})
+	}
+}
+
+func TestClient_DeleteHistoryArchiveError(t *testing.T) {
+	a, err := archive.Open(t.TempDir())
+	require.NoError(t, err)
+	defer a.Close()
+	peer := archive.Peer{Type: archive.PeerChat, ID: 5}
+	require.NoError(t, a.Store(archive.Message{Peer: peer, ID: 1}))
+
+	errTest := errors.New("test")
+	c := newFakeAPIClient(t, func(context.Context, bin.Encoder) (bin.Encoder, error) {
+		return nil, errTest
+	}, WithArchive(a))
+	_, err = c.DeleteHistory(context.Background(), &tg.Chat{ID: 5}, HistoryOptions{})
+	assert.ErrorIs(t, err, errTest)
+	assert.Equal(t, 1, a.Len(), "messages must stay archived on failure")
+}
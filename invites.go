@@ -0,0 +1,235 @@
+package mtpwrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// InviteOptions are the parameters of the invite link.
+type InviteOptions struct {
+	// Title is the description of the link, visible only to administrators.
+	Title string
+	// Expire is the expiration time of the link, zero means "never".
+	Expire time.Time
+	// UsageLimit is the maximum number of users that can join using the link,
+	// zero means "unlimited".
+	UsageLimit int
+	// RequestNeeded if set, requires the administrator to approve each user
+	// joining through the link.
+	RequestNeeded bool
+}
+
+// Importer is the user that joined or requested to join the chat using the
+// invite link.
+type Importer struct {
+	UserID     int64
+	Date       time.Time
+	Requested  bool   // join request is pending
+	About      string // bio of the user with the pending request
+	ApprovedBy int64
+
+	// User is the user object, if it was returned by the API.
+	User *tg.User
+}
+
+// CreateInvite creates a new invite link for the chat or channel dlg.
+func (c *Client) CreateInvite(ctx context.Context, dlg Entity, opts InviteOptions) (*tg.ChatInviteExported, error) {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.api().MessagesExportChatInvite(ctx, &tg.MessagesExportChatInviteRequest{
+		Peer:          ip,
+		Title:         opts.Title,
+		ExpireDate:    unixDate(opts.Expire),
+		UsageLimit:    opts.UsageLimit,
+		RequestNeeded: opts.RequestNeeded,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asChatInvite(resp)
+}
+
+// ListInvites returns the invite links of the chat or channel dlg, created by
+// the current user.  If revoked is true, it returns revoked links instead.
+func (c *Client) ListInvites(ctx context.Context, dlg Entity, revoked bool) ([]*tg.ChatInviteExported, error) {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		invites []*tg.ChatInviteExported
+		seen    int
+		req     = &tg.MessagesGetExportedChatInvitesRequest{
+			Revoked: revoked,
+			Peer:    ip,
+			AdminID: &tg.InputUserSelf{},
+			Limit:   defBatchSize,
+		}
+	)
+	for {
+		resp, err := c.api().MessagesGetExportedChatInvites(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, inv := range resp.Invites {
+			if ci, ok := inv.(*tg.ChatInviteExported); ok {
+				invites = append(invites, ci)
+			}
+		}
+		seen += len(resp.Invites)
+		if len(resp.Invites) < req.Limit || seen >= resp.Count {
+			break
+		}
+		last, ok := resp.Invites[len(resp.Invites)-1].(*tg.ChatInviteExported)
+		if !ok || (last.Date == req.OffsetDate && last.Link == req.OffsetLink) {
+			// no offset to continue from, or the same page again.
+			break
+		}
+		req.OffsetDate = last.Date
+		req.OffsetLink = last.Link
+	}
+	return invites, nil
+}
+
+// EditInvite changes the parameters of the invite link.
+func (c *Client) EditInvite(ctx context.Context, dlg Entity, link string, opts InviteOptions) (*tg.ChatInviteExported, error) {
+	return c.editInvite(ctx, dlg, &tg.MessagesEditExportedChatInviteRequest{
+		Link:          link,
+		Title:         opts.Title,
+		ExpireDate:    unixDate(opts.Expire),
+		UsageLimit:    opts.UsageLimit,
+		RequestNeeded: opts.RequestNeeded,
+	})
+}
+
+// RevokeInvite revokes the invite link.  If the link is the primary link of
+// the chat, telegram generates a new one, and it is returned instead.
+func (c *Client) RevokeInvite(ctx context.Context, dlg Entity, link string) (*tg.ChatInviteExported, error) {
+	return c.editInvite(ctx, dlg, &tg.MessagesEditExportedChatInviteRequest{
+		Link:    link,
+		Revoked: true,
+	})
+}
+
+func (c *Client) editInvite(ctx context.Context, dlg Entity, req *tg.MessagesEditExportedChatInviteRequest) (*tg.ChatInviteExported, error) {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return nil, err
+	}
+	req.Peer = ip
+	resp, err := c.api().MessagesEditExportedChatInvite(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	switch r := resp.(type) {
+	case *tg.MessagesExportedChatInvite:
+		return asChatInvite(r.Invite)
+	case *tg.MessagesExportedChatInviteReplaced:
+		return asChatInvite(r.NewInvite)
+	default:
+		return nil, fmt.Errorf("unexpected response type: %T", resp)
+	}
+}
+
+// DeleteInvite deletes the revoked invite link.
+func (c *Client) DeleteInvite(ctx context.Context, dlg Entity, link string) error {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return err
+	}
+	_, err = c.api().MessagesDeleteExportedChatInvite(ctx, &tg.MessagesDeleteExportedChatInviteRequest{
+		Peer: ip,
+		Link: link,
+	})
+	return err
+}
+
+// InviteImporters returns the users that joined the chat or channel dlg using
+// the invite link.
+func (c *Client) InviteImporters(ctx context.Context, dlg Entity, link string) ([]Importer, error) {
+	return c.importers(ctx, dlg, &tg.MessagesGetChatInviteImportersRequest{Link: link})
+}
+
+// JoinRequests returns the pending join requests of the chat or channel dlg.
+// If link is not empty, only requests made using this link are returned.
+func (c *Client) JoinRequests(ctx context.Context, dlg Entity, link string) ([]Importer, error) {
+	return c.importers(ctx, dlg, &tg.MessagesGetChatInviteImportersRequest{Link: link, Requested: true})
+}
+
+func (c *Client) importers(ctx context.Context, dlg Entity, req *tg.MessagesGetChatInviteImportersRequest) ([]Importer, error) {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return nil, err
+	}
+	req.Peer = ip
+	req.Limit = defBatchSize
+	req.OffsetUser = &tg.InputUserEmpty{}
+
+	var ii []Importer
+	for {
+		resp, err := c.api().MessagesGetChatInviteImporters(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		users := tg.UserClassArray(resp.Users).UserToMap()
+		for _, imp := range resp.Importers {
+			ii = append(ii, Importer{
+				UserID:     imp.UserID,
+				Date:       unixTime(imp.Date),
+				Requested:  imp.Requested,
+				About:      imp.About,
+				ApprovedBy: imp.ApprovedBy,
+				User:       users[imp.UserID],
+			})
+		}
+		if len(resp.Importers) < req.Limit || len(ii) >= resp.Count {
+			break
+		}
+		last := resp.Importers[len(resp.Importers)-1]
+		u, ok := users[last.UserID]
+		if !ok {
+			// can't paginate without the access hash.
+			break
+		}
+		req.OffsetDate = last.Date
+		req.OffsetUser = u.AsInput()
+	}
+	return ii, nil
+}
+
+// ApproveJoinRequest approves the pending join request of the user.
+func (c *Client) ApproveJoinRequest(ctx context.Context, dlg Entity, user tg.InputUserClass) error {
+	return c.hideJoinRequest(ctx, dlg, user, true)
+}
+
+// DeclineJoinRequest declines the pending join request of the user.
+func (c *Client) DeclineJoinRequest(ctx context.Context, dlg Entity, user tg.InputUserClass) error {
+	return c.hideJoinRequest(ctx, dlg, user, false)
+}
+
+func (c *Client) hideJoinRequest(ctx context.Context, dlg Entity, user tg.InputUserClass, approved bool) error {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return err
+	}
+	_, err = c.api().MessagesHideChatJoinRequest(ctx, &tg.MessagesHideChatJoinRequestRequest{
+		Approved: approved,
+		Peer:     ip,
+		UserID:   user,
+	})
+	return err
+}
+
+func asChatInvite(inv tg.ExportedChatInviteClass) (*tg.ChatInviteExported, error) {
+	ci, ok := inv.(*tg.ChatInviteExported)
+	if !ok {
+		return nil, fmt.Errorf("unexpected invite type: %T", inv)
+	}
+	return ci, nil
+}
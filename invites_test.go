@@ -0,0 +1,164 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_asChatInvite(t *testing.T) {
+	tests := []struct {
+		name    string
+		inv     tg.ExportedChatInviteClass
+		want    *tg.ChatInviteExported
+		wantErr bool
+	}{
+		{"exported", &tg.ChatInviteExported{Link: "a"}, &tg.ChatInviteExported{Link: "a"}, false},
+		{"public join requests", &tg.ChatInvitePublicJoinRequests{}, nil, true},
+		{"nil", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := asChatInvite(tt.inv)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("asChatInvite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClient_editInvite(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    tg.MessagesExportedChatInviteClass
+		want    string
+		wantErr bool
+	}{
+		{
+			"edited",
+			&tg.MessagesExportedChatInvite{Invite: &tg.ChatInviteExported{Link: "old"}},
+			"old",
+			false,
+		},
+		{
+			"replaced",
+			&tg.MessagesExportedChatInviteReplaced{
+				Invite:    &tg.ChatInviteExported{Link: "old", Revoked: true},
+				NewInvite: &tg.ChatInviteExported{Link: "new"},
+			},
+			"new",
+			false,
+		},
+		{
+			"unexpected invite",
+			&tg.MessagesExportedChatInvite{Invite: &tg.ChatInvitePublicJoinRequests{}},
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *tg.MessagesEditExportedChatInviteRequest
+			c := newFakeAPIClient(t, func(_ context.Context, req bin.Encoder) (bin.Encoder, error) {
+				got = req.(*tg.MessagesEditExportedChatInviteRequest)
+				return tt.resp, nil
+			})
+			inv, err := c.RevokeInvite(context.Background(), &tg.Chat{ID: 1}, "old")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RevokeInvite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.True(t, got.Revoked)
+			assert.Equal(t, &tg.InputPeerChat{ChatID: 1}, got.Peer)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, inv.Link)
+			}
+		})
+	}
+}
+
+// invitePages returns the fake API, that returns the invites in pages of
+// the requested size, starting after the offset link.
+func invitePages(invites []tg.ExportedChatInviteClass, calls *int) fakeAPI {
+	return func(_ context.Context, r bin.Encoder) (bin.Encoder, error) {
+		req, ok := r.(*tg.MessagesGetExportedChatInvitesRequest)
+		if !ok {
+			return nil, fmt.Errorf("unexpected request: %T", r)
+		}
+		*calls++
+		if *calls > 10 {
+			return nil, errors.New("too many calls")
+		}
+		start := 0
+		if req.OffsetLink != "" {
+			for i, inv := range invites {
+				if ci, ok := inv.(*tg.ChatInviteExported); ok && ci.Link == req.OffsetLink {
+					start = i + 1
+				}
+			}
+		}
+		end := min(start+req.Limit, len(invites))
+		return &tg.MessagesExportedChatInvites{Count: len(invites), Invites: invites[start:end]}, nil
+	}
+}
+
+func TestClient_ListInvites(t *testing.T) {
+	exported := func(n int) []tg.ExportedChatInviteClass {
+		ii := make([]tg.ExportedChatInviteClass, n)
+		for i := range ii {
+			ii[i] = &tg.ChatInviteExported{Link: fmt.Sprintf("link%d", i), Date: 1000 - i}
+		}
+		return ii
+	}
+	joinRequests := make([]tg.ExportedChatInviteClass, defBatchSize)
+	for i := range joinRequests {
+		joinRequests[i] = &tg.ChatInvitePublicJoinRequests{}
+	}
+	mixed := append(exported(defBatchSize-1), &tg.ChatInvitePublicJoinRequests{})
+	mixed = append(mixed, exported(2)...)
+
+	tests := []struct {
+		name      string
+		invites   []tg.ExportedChatInviteClass
+		wantLen   int
+		wantCalls int
+	}{
+		{"empty", nil, 0, 1},
+		{"one page", exported(3), 3, 1},
+		{"several pages", exported(2*defBatchSize + 1), 2*defBatchSize + 1, 3},
+		{"full page without exported invites", joinRequests, 0, 1},
+		{"page ends with non-exported invite", mixed, defBatchSize - 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			c := newFakeAPIClient(t, invitePages(tt.invites, &calls))
+			got, err := c.ListInvites(context.Background(), &tg.Chat{ID: 1}, false)
+			require.NoError(t, err)
+			assert.Len(t, got, tt.wantLen)
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
+
+func TestClient_ListInvites_samePage(t *testing.T) {
+	page := make([]tg.ExportedChatInviteClass, defBatchSize)
+	for i := range page {
+		page[i] = &tg.ChatInviteExported{Link: fmt.Sprintf("link%d", i), Date: 1000}
+	}
+	var calls int
+	c := newFakeAPIClient(t, func(context.Context, bin.Encoder) (bin.Encoder, error) {
+		calls++
+		return &tg.MessagesExportedChatInvites{Count: 10 * defBatchSize, Invites: page}, nil
+	})
+	got, err := c.ListInvites(context.Background(), &tg.Chat{ID: 1}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls, "must stop, when the offset doesn't move")
+	assert.Len(t, got, 2*defBatchSize)
+}
@@ -0,0 +1,140 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/rusq/mtpwrap/authflow"
+)
+
+// ErrNotRunning is returned by API calls, if the client is not started or is
+// stopping.
+var ErrNotRunning = errors.New("client is not running")
+
+// state is the lifecycle state of the client.
+type state int
+
+const (
+	stateIdle     state = iota // not running, can be started
+	stateStarting              // Start is connecting and authenticating
+	stateRunning               // running asynchronously (Start) or synchronously (Run)
+	stateStopping              // Stop is waiting for operations to drain
+)
+
+// these are variables to allow mocking in tests.
+var (
+	// runTelegram runs the telegram client.
+	runTelegram = func(ctx context.Context, cl *telegram.Client, f func(context.Context) error) error {
+		return cl.Run(ctx, f)
+	}
+	// authIfNecessary runs the authentication flow, if the session is not
+	// authorized.
+	authIfNecessary = func(ctx context.Context, cl *telegram.Client, flow auth.Flow) error {
+		return authflow.IfNecessary(ctx, cl.Auth(), cl.API(), flow)
+	}
+)
+
+// Done returns the channel that is closed when the running client stops.  If
+// the client is not running, the returned channel is closed.
+func (c *Client) Done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done
+}
+
+// begin transitions the client from idle to the state s, preparing a fresh
+// telegram client, if the previous one was used.  It returns the context that
+// is cancelled by Stop.
+func (c *Client) begin(ctx context.Context, s state) (context.Context, *telegram.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != stateIdle {
+		return nil, nil, ErrAlreadyRunning
+	}
+	// telegram client can't be run twice.
+	if c.spent {
+		c.cl = c.newTelegramClient()
+	}
+	c.spent = true
+	c.state = s
+	c.sync = s == stateRunning
+	if s == stateStarting {
+		c.setup.Add(1)
+	}
+	c.done = make(chan struct{})
+	// the drain of the previous run may still be waiting for its calls, the
+	// wait group can't be reused until it returns.
+	c.inflight = new(sync.WaitGroup)
+	ctx, c.cancel = context.WithCancel(ctx)
+	return ctx, c.cl, nil
+}
+
+// finish transitions the client to idle, and closes the Done channel.
+func (c *Client) finish(err error) {
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.state = stateIdle
+	c.stop = nil
+	c.cancel = nil
+	close(c.done)
+	c.mu.Unlock()
+	if c.waiterStop != nil {
+		c.waiterStop()
+	}
+	c.setStatus(StatusStopped, err)
+}
+
+// drain waits for the in-flight API calls of the current run to complete or
+// ctx to be cancelled.
+func (c *Client) drain(ctx context.Context) error {
+	c.mu.Lock()
+	inflight := c.inflight
+	c.mu.Unlock()
+	if inflight == nil {
+		return nil
+	}
+	drained := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquire registers the in-flight API call.  It returns ErrNotRunning if the
+// client is not running.  Caller must call Done on the returned wait group
+// when the call completes.
+func (c *Client) acquire() (*sync.WaitGroup, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != stateStarting && c.state != stateRunning {
+		return nil, ErrNotRunning
+	}
+	c.inflight.Add(1)
+	return c.inflight, nil
+}
+
+// trackInflight is the telegram middleware that tracks in-flight API calls, so
+// that Stop could wait for them to complete.
+func (c *Client) trackInflight(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		inflight, err := c.acquire()
+		if err != nil {
+			return err
+		}
+		defer inflight.Done()
+		return next.Invoke(ctx, input, output)
+	}
+}
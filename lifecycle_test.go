@@ -0,0 +1,248 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTelegram replaces the telegram client run and authentication functions
+// with fakes, that do not connect anywhere.
+func fakeTelegram(t *testing.T, authErr error) *atomic.Int32 {
+	t.Helper()
+	oldRun, oldAuth := runTelegram, authIfNecessary
+	t.Cleanup(func() {
+		runTelegram, authIfNecessary = oldRun, oldAuth
+	})
+	var running atomic.Int32
+	runTelegram = func(ctx context.Context, _ *telegram.Client, f func(context.Context) error) error {
+		running.Add(1)
+		defer running.Add(-1)
+		return f(ctx)
+	}
+	authIfNecessary = func(ctx context.Context, _ *telegram.Client, _ auth.Flow) error {
+		return authErr
+	}
+	return &running
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	c, err := New(context.Background(), 12345, "hash")
+	require.NoError(t, err)
+	return c
+}
+
+// fakeAPI handles the API request of the test client and returns the
+// response.
+type fakeAPI func(ctx context.Context, req bin.Encoder) (bin.Encoder, error)
+
+// newFakeAPIClient returns the test client, which API calls are handled by
+// api, and never reach the network.
+func newFakeAPIClient(t *testing.T, api fakeAPI, opts ...Option) *Client {
+	t.Helper()
+	mw := telegram.MiddlewareFunc(func(tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			resp, err := api(ctx, input)
+			if err != nil {
+				return err
+			}
+			var b bin.Buffer
+			if err := resp.Encode(&b); err != nil {
+				return err
+			}
+			return output.Decode(&b)
+		}
+	})
+	opts = append([]Option{WithMTPOptions(telegram.Options{Middlewares: []telegram.Middleware{mw}})}, opts...)
+	c, err := New(context.Background(), 12345, "hash", opts...)
+	require.NoError(t, err)
+	return c
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestClient_StartStop(t *testing.T) {
+	running := fakeTelegram(t, nil)
+	c := newTestClient(t)
+
+	assert.True(t, isClosed(c.Done()), "not running client must be done")
+	assert.NoError(t, c.Stop(), "stopping not running client")
+
+	for i := 0; i < 3; i++ { // restart
+		require.NoError(t, c.Start(context.Background()))
+		done := c.Done()
+		assert.False(t, isClosed(done))
+		assert.Equal(t, int32(1), running.Load())
+		assert.ErrorIs(t, c.Start(context.Background()), ErrAlreadyRunning)
+		assert.ErrorIs(t, c.Run(context.Background(), nil), ErrAlreadyRunning)
+
+		assert.NoError(t, c.Stop())
+		assert.NoError(t, c.Stop(), "stop must be idempotent")
+		assert.True(t, isClosed(done))
+		assert.Equal(t, int32(0), running.Load())
+	}
+}
+
+func TestClient_StartAuthError(t *testing.T) {
+	errTest := errors.New("test")
+	running := fakeTelegram(t, errTest)
+	c := newTestClient(t)
+
+	err := c.Start(context.Background())
+	var ea *ErrAuth
+	assert.ErrorAs(t, err, &ea)
+	assert.ErrorIs(t, err, errTest)
+	assert.True(t, isClosed(c.Done()))
+	assert.Equal(t, int32(0), running.Load())
+
+	// can be started again.
+	fakeTelegram(t, nil)
+	require.NoError(t, c.Start(context.Background()))
+	assert.NoError(t, c.Stop())
+}
+
+func TestClient_StartConcurrent(t *testing.T) {
+	fakeTelegram(t, nil)
+	c := newTestClient(t)
+
+	const n = 16
+	var (
+		wg      sync.WaitGroup
+		started atomic.Int32
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.Start(context.Background())
+			if err == nil {
+				started.Add(1)
+				return
+			}
+			assert.ErrorIs(t, err, ErrAlreadyRunning)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), started.Load(), "exactly one Start must succeed")
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, c.Stop())
+		}()
+	}
+	wg.Wait()
+	assert.True(t, isClosed(c.Done()))
+}
+
+func TestClient_StopDrainsInflight(t *testing.T) {
+	fakeTelegram(t, nil)
+	c := newTestClient(t)
+	require.NoError(t, c.Start(context.Background()))
+
+	inflight, err := c.acquire()
+	require.NoError(t, err)
+	var stopped atomic.Bool
+	go func() {
+		c.Stop()
+		stopped.Store(true)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, stopped.Load(), "must wait for in-flight calls")
+	_, err = c.acquire()
+	assert.ErrorIs(t, err, ErrNotRunning, "new calls must be rejected while stopping")
+
+	inflight.Done()
+	<-c.Done()
+	assert.Eventually(t, stopped.Load, time.Second, 10*time.Millisecond)
+}
+
+func TestClient_ShutdownTimeout(t *testing.T) {
+	fakeTelegram(t, nil)
+	c := newTestClient(t)
+	require.NoError(t, c.Start(context.Background()))
+
+	inflight, err := c.acquire()
+	require.NoError(t, err)
+	defer inflight.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, c.Shutdown(ctx), context.DeadlineExceeded)
+	assert.True(t, isClosed(c.Done()), "client must be stopped regardless")
+}
+
+func TestClient_RestartAfterShutdownTimeout(t *testing.T) {
+	fakeTelegram(t, nil)
+	c := newTestClient(t)
+	require.NoError(t, c.Start(context.Background()))
+
+	// the call outlives the timed out shutdown, and the restart.
+	stale, err := c.acquire()
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, c.Shutdown(ctx), context.DeadlineExceeded)
+
+	require.NoError(t, c.Start(context.Background()))
+	inflight, err := c.acquire()
+	require.NoError(t, err)
+	stale.Done()
+
+	var stopped atomic.Bool
+	go func() {
+		c.Stop()
+		stopped.Store(true)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, stopped.Load(), "must wait for the calls of the current run")
+
+	inflight.Done()
+	<-c.Done()
+	assert.Eventually(t, stopped.Load, time.Second, 10*time.Millisecond)
+}
+
+func TestClient_RunStop(t *testing.T) {
+	fakeTelegram(t, nil)
+	c := newTestClient(t)
+
+	errC := make(chan error, 1)
+	inRun := make(chan struct{})
+	go func() {
+		errC <- c.Run(context.Background(), func(ctx context.Context, _ *telegram.Client) error {
+			close(inRun)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	<-inRun
+	assert.ErrorIs(t, c.Start(context.Background()), ErrAlreadyRunning)
+	assert.NoError(t, c.Stop())
+	<-c.Done()
+	assert.ErrorIs(t, <-errC, context.Canceled)
+
+	// stop from within the function must not deadlock.
+	assert.NoError(t, c.Run(context.Background(), func(ctx context.Context, _ *telegram.Client) error {
+		return c.Stop()
+	}))
+}
@@ -35,15 +35,18 @@ func (c *Client) SearchAllMessages(ctx context.Context, dlg Entity, who tg.Input
 		return nil, err
 	}
 
-	bld := query.Messages(c.cl.API()).
+	bld := query.Messages(c.api()).
 		Search(ip).
 		BatchSize(defBatchSize).
 		FromID(who).
 		Filter(&tg.InputMessagesFilterEmpty{})
-	elems, err := collectMessages(ctx, bld, cb)
+	elems, err := collectMessages(ctx, bld.Iter(), cb)
 	if err != nil {
 		return nil, err
 	}
+	if err := c.archiveMessages(dlg, elems); err != nil {
+		return nil, err
+	}
 
 	if err := c.cache.Set(cacheKey(dlg.GetID()), elems); err != nil {
 		return nil, err
@@ -51,7 +54,46 @@ func (c *Client) SearchAllMessages(ctx context.Context, dlg Entity, who tg.Input
 	return elems, err
 }
 
+// GetHistory returns the whole message history of the chat or channel `dlg`,
+// newest messages first.  For each message received, the callback function
+// will be invoked, if not nil.
+func (c *Client) GetHistory(ctx context.Context, dlg Entity, cb func(n int)) ([]messages.Elem, error) {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return nil, err
+	}
+	bld := query.Messages(c.api()).
+		GetHistory(ip).
+		BatchSize(defBatchSize)
+	elems, err := collectMessages(ctx, bld.Iter(), cb)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.archiveMessages(dlg, elems); err != nil {
+		return nil, err
+	}
+	return elems, nil
+}
+
+// DeleteMessages deletes the messages in the chat, channel or private chat
+// `dlg` for all participants.  It returns the number of deleted messages,
+// on error, the number of messages deleted before it.
 func (c *Client) DeleteMessages(ctx context.Context, dlg Entity, messages []messages.Elem) (int, error) {
+	return c.deleteMessages(ctx, dlg, messages, true)
+}
+
+// DeleteMessagesForMe deletes the messages in the basic chat or private chat
+// `dlg` only for the current user, other participants will still see them.
+// In channels and supergroups messages are always deleted for everyone, so
+// it returns ErrChannel for them.
+func (c *Client) DeleteMessagesForMe(ctx context.Context, dlg Entity, messages []messages.Elem) (int, error) {
+	if _, ok := dlg.(*tg.Channel); ok {
+		return 0, ErrChannel
+	}
+	return c.deleteMessages(ctx, dlg, messages, false)
+}
+
+func (c *Client) deleteMessages(ctx context.Context, dlg Entity, messages []messages.Elem, revoke bool) (int, error) {
 	ctx, task := trace.NewTask(ctx, "DeleteMessages")
 	defer task.End()
 
@@ -70,12 +112,23 @@ func (c *Client) DeleteMessages(ctx context.Context, dlg Entity, messages []mess
 
 	total := 0
 	for _, chunk := range ids {
-		resp, err := message.NewSender(c.cl.API()).To(ip).Revoke().Messages(ctx, chunk...)
+		var (
+			resp   *tg.MessagesAffectedMessages
+			sender = message.NewSender(c.api())
+		)
+		if revoke {
+			resp, err = sender.To(ip).Revoke().Messages(ctx, chunk...)
+		} else {
+			resp, err = sender.Delete().Messages(ctx, chunk...)
+		}
 		if err != nil {
-			trace.Logf(ctx, "api", "revoke error: %s", err)
-			return 0, fmt.Errorf("failed to delete: %w", err)
+			trace.Logf(ctx, "api", "delete error: %s", err)
+			return total, fmt.Errorf("failed to delete: %w", err)
 		}
 		total += resp.GetPtsCount()
+		if err := c.unarchiveMessages(dlg, chunk); err != nil {
+			return total, err
+		}
 	}
 	trace.Log(ctx, "logic", "ok")
 	return total, nil
@@ -87,6 +140,8 @@ func asInputPeer(ent Entity) (tg.InputPeerClass, error) {
 		return peer.AsInputPeer(), nil
 	case *tg.Channel:
 		return peer.AsInputPeer(), nil
+	case UserEntity:
+		return peer.AsInputPeer(), nil
 	default:
 		return nil, fmt.Errorf("unsupported input peer type: %T", peer)
 	}
@@ -113,10 +168,9 @@ func splitBy[T, S any](n int, input []S, fn func(i int) T) [][]T {
 }
 
 // collectMessages is the copy/pasta from the td/telegram/message package with added
-// optional callback function. It creates iterator and collects all elements to
+// optional callback function. It collects all elements of the iterator to
 // slice, calling callback function for each iteration, if it's not nil.
-func collectMessages(ctx context.Context, b *messages.SearchQueryBuilder, cb func(n int)) ([]messages.Elem, error) {
-	iter := b.Iter()
+func collectMessages(ctx context.Context, iter *messages.Iterator, cb func(n int)) ([]messages.Elem, error) {
 	c, err := iter.Total(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get total: %w", err)
@@ -3,6 +3,8 @@ package mtpwrap
 import (
 	"reflect"
 	"testing"
+
+	"github.com/gotd/td/tg"
 )
 
 func Test_splitBy(t *testing.T) {
@@ -85,3 +87,29 @@ func Test_splitBy(t *testing.T) {
 		})
 	}
 }
+
+func Test_asInputPeer(t *testing.T) {
+	tests := []struct {
+		name    string
+		ent     Entity
+		want    tg.InputPeerClass
+		wantErr bool
+	}{
+		{"chat", &tg.Chat{ID: 1}, &tg.InputPeerChat{ChatID: 1}, false},
+		{"channel", &tg.Channel{ID: 2}, &tg.InputPeerChannel{ChannelID: 2}, false},
+		{"user", UserEntity{&tg.User{ID: 3}}, &tg.InputPeerUser{UserID: 3}, false},
+		{"unsupported", &tg.ChatForbidden{ID: 4}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := asInputPeer(tt.ent)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("asInputPeer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("asInputPeer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
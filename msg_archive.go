@@ -0,0 +1,174 @@
+package mtpwrap
+
+import (
+	"context"
+	"fmt"
+	"runtime/trace"
+
+	"github.com/gotd/td/telegram/query"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+
+	"github.com/rusq/mtpwrap/archive"
+)
+
+// WithArchive sets the local message archive.  Messages, fetched by the
+// search and history calls, are stored in the archive, and deleted messages
+// are removed from it.  The caller is responsible for closing the archive.
+func WithArchive(a *archive.Archive) Option {
+	return func(c *Client) {
+		c.archive = a
+	}
+}
+
+// SyncArchive fetches the messages of the chat or channel dlg that are newer
+// than the latest archived message, and stores them in the archive.  For each
+// message received, the callback function will be invoked, if not nil.  It
+// returns the number of messages fetched.
+func (c *Client) SyncArchive(ctx context.Context, dlg Entity, cb func(n int)) (int, error) {
+	ctx, task := trace.NewTask(ctx, "SyncArchive")
+	defer task.End()
+
+	if c.archive == nil {
+		return 0, fmt.Errorf("archive is not configured")
+	}
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return 0, err
+	}
+	peer, err := archivePeer(dlg)
+	if err != nil {
+		return 0, err
+	}
+	lastID := c.archive.LastID(peer)
+	trace.Logf(ctx, "archive", "last id: %d", lastID)
+
+	// history is returned newest first, so we stop at the first archived
+	// message.
+	iter := query.Messages(c.api()).
+		GetHistory(ip).
+		BatchSize(defBatchSize).
+		Iter()
+	var elems []messages.Elem
+	for iter.Next(ctx) {
+		elem := iter.Value()
+		if elem.Msg.GetID() <= lastID {
+			break
+		}
+		elems = append(elems, elem)
+		if cb != nil {
+			cb(1)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+	if err := c.archiveMessages(dlg, elems); err != nil {
+		return 0, err
+	}
+	return len(elems), nil
+}
+
+// archiveMessages stores the messages of dlg in the archive, if it's set.
+func (c *Client) archiveMessages(dlg Entity, elems []messages.Elem) error {
+	if c.archive == nil || len(elems) == 0 {
+		return nil
+	}
+	peer, err := archivePeer(dlg)
+	if err != nil {
+		return err
+	}
+	msgs := make([]archive.Message, 0, len(elems))
+	for _, elem := range elems {
+		if m, ok := archiveMessage(peer, elem.Msg); ok {
+			msgs = append(msgs, m)
+		}
+	}
+	if err := c.archive.Store(msgs...); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	return nil
+}
+
+// unarchiveMessages removes the messages of dlg from the archive, if it's set.
+func (c *Client) unarchiveMessages(dlg Entity, ids []int) error {
+	if c.archive == nil || len(ids) == 0 {
+		return nil
+	}
+	peer, err := archivePeer(dlg)
+	if err != nil {
+		return err
+	}
+	if err := c.archive.Delete(peer, ids...); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	return nil
+}
+
+// unarchiveHistory removes the archived messages of dlg, that match, from the
+// archive, if it's set.
+func (c *Client) unarchiveHistory(dlg Entity, match func(archive.Message) bool) error {
+	if c.archive == nil {
+		return nil
+	}
+	peer, err := archivePeer(dlg)
+	if err != nil {
+		return err
+	}
+	msgs, err := c.archive.Search(archive.Query{Peer: peer})
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	var ids []int
+	for _, m := range msgs {
+		if match(m) {
+			ids = append(ids, m.ID)
+		}
+	}
+	return c.unarchiveMessages(dlg, ids)
+}
+
+// archivePeer returns the archive peer of the chat, channel or user.
+func archivePeer(ent Entity) (archive.Peer, error) {
+	switch ent.(type) {
+	case *tg.Chat:
+		return archive.Peer{Type: archive.PeerChat, ID: ent.GetID()}, nil
+	case *tg.Channel:
+		return archive.Peer{Type: archive.PeerChannel, ID: ent.GetID()}, nil
+	case UserEntity:
+		return archive.Peer{Type: archive.PeerUser, ID: ent.GetID()}, nil
+	default:
+		return archive.Peer{}, fmt.Errorf("unsupported archive peer type: %T", ent)
+	}
+}
+
+// archiveMessage converts the message to the archive message.  Service
+// messages are not archived.
+func archiveMessage(peer archive.Peer, msg tg.NotEmptyMessage) (archive.Message, bool) {
+	m, ok := msg.(*tg.Message)
+	if !ok {
+		return archive.Message{}, false
+	}
+	am := archive.Message{
+		Peer:     peer,
+		ID:       m.ID,
+		TopicID:  messageTopicID(m),
+		Date:     unixTime(m.Date),
+		EditDate: unixTimePtr(m.EditDate),
+		Text:     m.Message,
+	}
+	switch from := m.FromID.(type) {
+	case *tg.PeerUser:
+		am.FromID = from.UserID
+	case *tg.PeerChannel:
+		am.FromID = from.ChannelID
+	case *tg.PeerChat:
+		am.FromID = from.ChatID
+	default:
+		// messages in channels and private chats have no sender.
+		if pu, ok := m.PeerID.(*tg.PeerUser); ok && !m.Out {
+			am.FromID = pu.UserID
+		}
+	}
+	return am, true
+}
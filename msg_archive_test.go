@@ -0,0 +1,90 @@
+package mtpwrap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rusq/mtpwrap/archive"
+)
+
+func Test_archiveMessage(t *testing.T) {
+	editDate := time.Unix(1700000060, 0)
+	tests := []struct {
+		name   string
+		msg    tg.NotEmptyMessage
+		want   archive.Message
+		wantOk bool
+	}{
+		{
+			"group message",
+			&tg.Message{ID: 1, FromID: &tg.PeerUser{UserID: 10}, PeerID: &tg.PeerChannel{ChannelID: 2}, Date: 1700000000, Message: "hi"},
+			archive.Message{Peer: archive.Peer{Type: archive.PeerChannel, ID: 2}, ID: 1, FromID: 10, Date: time.Unix(1700000000, 0), Text: "hi"},
+			true,
+		},
+		{
+			"incoming private message",
+			&tg.Message{ID: 2, PeerID: &tg.PeerUser{UserID: 10}, Date: 1700000000, EditDate: 1700000060},
+			archive.Message{Peer: archive.Peer{Type: archive.PeerUser, ID: 10}, ID: 2, FromID: 10, Date: time.Unix(1700000000, 0), EditDate: &editDate},
+			true,
+		},
+		{
+			"topic message",
+			&tg.Message{ID: 5, FromID: &tg.PeerUser{UserID: 10}, PeerID: &tg.PeerChannel{ChannelID: 2}, ReplyTo: &tg.MessageReplyHeader{ForumTopic: true, ReplyToMsgID: 4}, Date: 1700000000},
+			archive.Message{Peer: archive.Peer{Type: archive.PeerChannel, ID: 2}, ID: 5, TopicID: 4, FromID: 10, Date: time.Unix(1700000000, 0)},
+			true,
+		},
+		{
+			"channel post",
+			&tg.Message{ID: 3, PeerID: &tg.PeerChannel{ChannelID: 2}, Date: 1700000000},
+			archive.Message{Peer: archive.Peer{Type: archive.PeerChannel, ID: 2}, ID: 3, Date: time.Unix(1700000000, 0)},
+			true,
+		},
+		{
+			"service message",
+			&tg.MessageService{ID: 4},
+			archive.Message{},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := archiveMessage(tt.want.Peer, tt.msg)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestClient_archiveMessages(t *testing.T) {
+	a, err := archive.Open(t.TempDir())
+	require.NoError(t, err)
+	defer a.Close()
+
+	c := &Client{archive: a}
+	chat := &tg.Chat{ID: 5}
+	elems := []messages.Elem{
+		{Msg: &tg.Message{ID: 1, PeerID: &tg.PeerChat{ChatID: 5}, Message: "one"}},
+		{Msg: &tg.Message{ID: 2, PeerID: &tg.PeerChat{ChatID: 5}, Message: "two"}},
+	}
+	require.NoError(t, c.archiveMessages(chat, elems))
+	peer := archive.Peer{Type: archive.PeerChat, ID: 5}
+	assert.Equal(t, 2, a.LastID(peer))
+	assert.Zero(t, a.LastID(archive.Peer{Type: archive.PeerChannel, ID: 5}))
+
+	require.NoError(t, c.unarchiveMessages(chat, []int{1}))
+	got, err := a.Search(archive.Query{Peer: peer})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "two", got[0].Text)
+
+	err = c.archiveMessages(&tg.ChatForbidden{ID: 5}, elems)
+	assert.Error(t, err, "unsupported peer")
+
+	// no archive is not an error.
+	assert.NoError(t, (&Client{}).archiveMessages(chat, elems))
+}
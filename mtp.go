@@ -6,20 +6,23 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bluele/gcache"
-	"github.com/gotd/contrib/bg"
 	"github.com/gotd/contrib/middleware/floodwait"
 	"github.com/gotd/contrib/storage"
 	"github.com/gotd/td/session"
 	"github.com/gotd/td/tdp"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
 	"github.com/mattn/go-colorable"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"github.com/rusq/mtpwrap/archive"
 	"github.com/rusq/mtpwrap/authflow"
 )
 
@@ -41,21 +44,42 @@ type ErrAuth struct {
 }
 
 type Client struct {
+	mu sync.Mutex // guards cl, the lifecycle and status fields
 	cl *telegram.Client
 
 	cache     gcache.Cache
 	peerStrg  storage.PeerStorage
+	dlgSync   dialogSync
+	archive   *archive.Archive
 	credsStrg credsStorage
 	creds     creds // API credentials
 
 	waiter     *floodwait.SimpleWaiter
 	waiterStop func()
 
-	stop bg.StopFunc
+	// lifecycle
+	state    state
+	sync     bool               // running synchronously with Run
+	spent    bool               // cl was run, and must be recreated
+	cancel   context.CancelFunc // cancels the Start or Run context
+	stop     func() error       // stops the connection started by Start
+	done     chan struct{}      // closed when the client stops
+	setup    sync.WaitGroup     // Start connecting and authenticating
+	inflight *sync.WaitGroup    // in-flight API calls of the current run
+
+	status         Status
+	statusC        chan StatusEvent
+	statusFn       func(StatusEvent)
+	healthInterval time.Duration
+	supStop        chan struct{} // closed to stop the supervisor
+	supDone        chan struct{} // closed when the supervisor exits
 
 	auth         authflow.FullAuthFlow
 	sendcodeOpts auth.SendCodeOptions
 	telegramOpts telegram.Options
+	proxy        *Proxy
+	optSrc       map[string]string // telegramOpts field -> option that set it
+	optErr       error             // errors of the options, reported by New
 }
 
 // Entity interface is the subset of functions that are commonly defined on most
@@ -68,6 +92,17 @@ type Entity interface {
 	Zero() bool
 }
 
+// UserEntity wraps the telegram user to satisfy the Entity interface, as users
+// have names instead of titles.
+type UserEntity struct {
+	*tg.User
+}
+
+// GetTitle returns the full name of the user.
+func (u UserEntity) GetTitle() string {
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
 type cacheKey int64
 
 const (
@@ -76,9 +111,15 @@ const (
 
 type Option func(c *Client)
 
+// WithMTPOptions merges opts into the telegram client options: the non-zero
+// fields are set, and the middlewares are appended.  Setting the field, that
+// is also set by another option, i.e. SessionStorage and WithStorage, is
+// reported by New as a conflict.
 func WithMTPOptions(opts telegram.Options) Option {
 	return func(c *Client) {
-		c.telegramOpts = opts
+		for _, field := range mergeOptions(&c.telegramOpts, opts) {
+			c.setOpt(field, "WithMTPOptions")
+		}
 	}
 }
 
@@ -86,6 +127,7 @@ func WithMTPOptions(opts telegram.Options) Option {
 func WithStorage(path string) Option {
 	return func(c *Client) {
 		c.telegramOpts.SessionStorage = &session.FileStorage{Path: path}
+		c.setOpt("SessionStorage", "WithStorage")
 	}
 }
 
@@ -115,7 +157,11 @@ func WithApiCredsFile(path string) Option {
 func WithDebug(enable bool) Option {
 	return func(c *Client) {
 		if !enable {
-			c.telegramOpts.Logger = nil
+			// only remove the logger set by this option.
+			if c.optSrc["Logger"] == "WithDebug" {
+				c.telegramOpts.Logger = nil
+				delete(c.optSrc, "Logger")
+			}
 			return
 		}
 		cfg := zap.NewDevelopmentEncoderConfig()
@@ -125,6 +171,7 @@ func WithDebug(enable bool) Option {
 			zapcore.AddSync(colorable.NewColorableStdout()),
 			zapcore.DebugLevel,
 		))
+		c.setOpt("Logger", "WithDebug")
 	}
 }
 
@@ -137,19 +184,43 @@ func New(ctx context.Context, appID int, appHash string, opts ...Option) (*Clien
 		auth:   authflow.TermAuth{}, // default is the terminal authentication
 		waiter: floodwait.NewSimpleWaiter(),
 
+		statusC: make(chan StatusEvent, statusBufSz),
+		done:    make(chan struct{}),
+
 		telegramOpts: telegram.Options{},
+		optSrc:       make(map[string]string),
 	}
 
 	for _, opt := range opts {
 		opt(&c)
 	}
+	if c.proxy != nil {
+		c.setOpt("Resolver", "proxy option")
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	if c.proxy != nil {
+		resolver, err := c.proxy.resolver()
+		if err != nil {
+			return nil, fmt.Errorf("proxy %s: %w", c.proxy, err)
+		}
+		c.telegramOpts.Resolver = resolver
+	}
 
 	var creds = creds{
 		ID:   appID,
 		Hash: appHash,
 	}
 
-	c.telegramOpts.Middlewares = append(c.telegramOpts.Middlewares, c.waiter)
+	close(c.done) // not running
+	// keep the peer storage up to date with the peers from updates.
+	next := c.telegramOpts.UpdateHandler
+	if next == nil {
+		next = telegram.UpdateHandlerFunc(func(context.Context, tg.UpdatesClass) error { return nil })
+	}
+	c.telegramOpts.UpdateHandler = storage.UpdateHook(next, c.peerStrg)
+	c.telegramOpts.Middlewares = append(c.telegramOpts.Middlewares, c.waiter, telegram.MiddlewareFunc(c.trackInflight))
 	if creds.IsEmpty() && c.credsStrg.IsAvailable() {
 		var err error
 		creds, err = c.loadCredentials(ctx)
@@ -160,12 +231,18 @@ func New(ctx context.Context, appID int, appHash string, opts ...Option) (*Clien
 		}
 	}
 
-	c.cl = telegram.NewClient(creds.ID, creds.Hash, c.telegramOpts)
 	c.creds = creds
+	c.cl = c.newTelegramClient()
 
 	return &c, nil
 }
 
+// newTelegramClient creates a new telegram client with the client
+// credentials and options.
+func (c *Client) newTelegramClient() *telegram.Client {
+	return telegram.NewClient(c.creds.ID, c.creds.Hash, c.telegramOpts)
+}
+
 var ErrNoCredentials = errors.New("no credentials")
 
 func (c *Client) loadCredentials(ctx context.Context) (creds, error) {
@@ -189,27 +266,30 @@ func (c *Client) loadCredentials(ctx context.Context) (creds, error) {
 	return creds, nil
 }
 
-// Start starts the telegram session in goroutine
+// Start starts the telegram session in goroutine.  If the health check is
+// enabled with WithHealthCheck, the connection is supervised until Stop is
+// called.  The client can be started again after it's stopped.
 func (c *Client) Start(ctx context.Context) error {
-	if c.stop != nil {
-		return ErrAlreadyRunning
-	}
 	if c.creds.IsEmpty() {
 		return ErrNoCredentials
 	}
-
-	stop, err := bg.Connect(c.cl)
+	ctx, cl, err := c.begin(ctx, stateStarting)
 	if err != nil {
 		return err
 	}
-	c.stop = stop
+	defer c.setup.Done()
 
-	flow := auth.NewFlow(c.auth, c.sendcodeOpts)
-	if err := c.cl.Auth().IfNecessary(ctx, flow); err != nil {
-		if err := c.Stop(); err != nil {
-			Log.Debugf("error stopping: %s", err)
-		}
-		return &ErrAuth{Err: err}
+	c.setStatus(StatusConnecting, nil)
+	cn, err := connect(ctx, cl)
+	if err != nil {
+		return c.abortStart(err)
+	}
+	c.mu.Lock()
+	c.stop = cn.stop
+	c.mu.Unlock()
+
+	if err := c.authenticate(ctx); err != nil {
+		return c.abortStart(err)
 	}
 	Log.Debug("auth success")
 
@@ -219,6 +299,52 @@ func (c *Client) Start(ctx context.Context) error {
 		Log.Printf("failed to save credentials: %s, but nevermind let's continue", err)
 	}
 
+	c.mu.Lock()
+	if c.state != stateStarting {
+		// Stop was called while we were starting, it will clean up.
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+	c.state = stateRunning
+	if c.healthInterval > 0 {
+		c.supStop = make(chan struct{})
+		c.supDone = make(chan struct{})
+		go c.supervise(cn, c.supStop, c.supDone)
+	}
+	c.mu.Unlock()
+	c.setStatus(StatusReady, nil)
+
+	return nil
+}
+
+// abortStart stops the connection, if any, and returns the client to idle
+// state, unless Stop is already doing it.  It returns err.
+func (c *Client) abortStart(err error) error {
+	c.mu.Lock()
+	if c.state == stateStopping {
+		c.mu.Unlock()
+		return err
+	}
+	c.state = stateStopping
+	stop := c.stop
+	c.mu.Unlock()
+
+	if stop != nil {
+		if err := stop(); err != nil {
+			Log.Debugf("error stopping: %s", err)
+		}
+	}
+	c.finish(err)
+	return err
+}
+
+// authenticate runs the authentication flow, if necessary.  It returns
+// ErrAuth on failure.
+func (c *Client) authenticate(ctx context.Context) error {
+	flow := auth.NewFlow(c.auth, c.sendcodeOpts)
+	if err := authIfNecessary(ctx, c.Client(), flow); err != nil {
+		return &ErrAuth{Err: err}
+	}
 	return nil
 }
 
@@ -234,27 +360,103 @@ func (e *ErrAuth) Is(err error) bool {
 	return errors.Is(e.Err, err)
 }
 
+// Stop stops the client, waiting for in-flight API calls to complete.  It is
+// safe to call Stop several times, or on a client that is not running.
 func (c *Client) Stop() error {
-	if c.stop != nil {
-		if c.waiterStop != nil {
-			defer c.waiterStop()
+	return c.Shutdown(context.Background())
+}
+
+// Shutdown stops the client, like Stop, but waits for in-flight API calls only
+// until ctx is cancelled, after which the connection is closed regardless.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	switch c.state {
+	case stateIdle:
+		c.mu.Unlock()
+		return nil
+	case stateStopping:
+		done, isSync := c.done, c.sync
+		c.mu.Unlock()
+		if isSync {
+			return nil
 		}
-		return c.stop()
+		return waitDone(ctx, done)
+	}
+	c.state = stateStopping
+	c.cancel()
+	isSync := c.sync
+	c.mu.Unlock()
+
+	if isSync {
+		// Run cleans up after itself, and Stop may be called from within the
+		// Run function, so we don't wait for it.  Use Done to wait.
+		return nil
+	}
+
+	c.setup.Wait()
+	c.mu.Lock()
+	supStop, supDone := c.supStop, c.supDone
+	c.supStop, c.supDone = nil, nil
+	c.mu.Unlock()
+	if supStop != nil {
+		close(supStop)
+		<-supDone
+	}
+
+	err := c.drain(ctx)
+	c.mu.Lock()
+	stop := c.stop
+	c.mu.Unlock()
+	if stop != nil {
+		if stopErr := stop(); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+	c.finish(nil)
+	return err
+}
+
+func waitDone(ctx context.Context, done <-chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil
 }
 
-// Run runs an arbitrary telegram session.
+// Run runs an arbitrary telegram session.  It blocks until fn returns, or the
+// client is stopped with Stop, which cancels the fn context.
 func (c *Client) Run(ctx context.Context, fn func(context.Context, *telegram.Client) error) error {
-	if c.stop != nil {
-		return ErrAlreadyRunning
+	ctx, cl, err := c.begin(ctx, stateRunning)
+	if err != nil {
+		return err
 	}
-	return c.cl.Run(ctx, func(ctx context.Context) error {
-		return fn(ctx, c.cl)
+	err = runTelegram(ctx, cl, func(ctx context.Context) error {
+		c.setStatus(StatusReady, nil)
+		return fn(ctx, cl)
 	})
+
+	c.mu.Lock()
+	c.state = stateStopping
+	c.mu.Unlock()
+	if drainErr := c.drain(context.Background()); drainErr != nil {
+		Log.Debugf("error draining: %s", drainErr)
+	}
+	c.finish(err)
+	return err
 }
 
-// Client returns the underlying telegram client.
+// Client returns the underlying telegram client.  The client may be replaced
+// when the connection is re-established by the supervisor, so don't hold on
+// to it.
 func (c *Client) Client() *telegram.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.cl
 }
+
+// api returns the raw API client of the current telegram client.
+func (c *Client) api() *tg.Client {
+	return c.Client().API()
+}
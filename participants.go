@@ -0,0 +1,397 @@
+package mtpwrap
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram/query/channels/participants"
+	"github.com/gotd/td/tg"
+)
+
+// ErrNoParticipants is returned if the participant list of the chat is not
+// available to the current user.
+var ErrNoParticipants = errors.New("participants list is not available")
+
+// Role is the role of the participant in the chat or channel.
+type Role string
+
+const (
+	RoleMember  Role = "member"
+	RoleAdmin   Role = "admin"
+	RoleCreator Role = "creator"
+	RoleBanned  Role = "banned"
+	RoleLeft    Role = "left"
+)
+
+// Participant is a member of the chat or channel.
+type Participant struct {
+	UserID    int64      `json:"user_id"`
+	Username  string     `json:"username,omitempty"`
+	FirstName string     `json:"first_name,omitempty"`
+	LastName  string     `json:"last_name,omitempty"`
+	Phone     string     `json:"phone,omitempty"`
+	Bot       bool       `json:"bot,omitempty"`
+	Role      Role       `json:"role"`
+	Rank      string     `json:"rank,omitempty"`
+	InviterID int64      `json:"inviter_id,omitempty"`
+	Date      *time.Time `json:"date,omitempty"` // date of joining, nil for the creator
+
+	// User is the user object, if it was returned by the API.
+	User *tg.User `json:"-"`
+}
+
+func (p *Participant) setUser(u *tg.User) {
+	if u == nil {
+		return
+	}
+	p.User = u
+	p.Username = u.Username
+	p.FirstName = u.FirstName
+	p.LastName = u.LastName
+	p.Phone = u.Phone
+	p.Bot = u.Bot
+}
+
+// ParticipantFilter selects the participants.  For supergroups and channels
+// the filtering is done by telegram, for basic chats it is done locally.
+type ParticipantFilter struct {
+	channel tg.ChannelParticipantsFilterClass
+	chat    func(Participant) bool
+}
+
+// ParticipantsAll selects all participants, that telegram is willing to
+// return.
+func ParticipantsAll() ParticipantFilter {
+	return ParticipantsSearch("")
+}
+
+// ParticipantsRecent selects recently active participants.
+func ParticipantsRecent() ParticipantFilter {
+	return ParticipantFilter{
+		channel: &tg.ChannelParticipantsRecent{},
+		chat:    func(Participant) bool { return true },
+	}
+}
+
+// ParticipantsAdmins selects administrators and the creator.
+func ParticipantsAdmins() ParticipantFilter {
+	return ParticipantFilter{
+		channel: &tg.ChannelParticipantsAdmins{},
+		chat: func(p Participant) bool {
+			return p.Role == RoleAdmin || p.Role == RoleCreator
+		},
+	}
+}
+
+// ParticipantsBots selects bots.
+func ParticipantsBots() ParticipantFilter {
+	return ParticipantFilter{
+		channel: &tg.ChannelParticipantsBots{},
+		chat:    func(p Participant) bool { return p.Bot },
+	}
+}
+
+// ParticipantsBanned selects banned participants, which names match the
+// query.  Empty query selects all banned participants.  Basic chats have no
+// ban list.
+func ParticipantsBanned(q string) ParticipantFilter {
+	return ParticipantFilter{
+		channel: &tg.ChannelParticipantsKicked{Q: q},
+		chat:    func(p Participant) bool { return false },
+	}
+}
+
+// ParticipantsSearch selects participants, which name, username or phone
+// match the query.
+func ParticipantsSearch(q string) ParticipantFilter {
+	return ParticipantFilter{
+		channel: &tg.ChannelParticipantsSearch{Q: q},
+		chat:    func(p Participant) bool { return p.matches(q) },
+	}
+}
+
+// matches returns true, if the query is a case-insensitive substring of
+// participant's name, username or phone.
+func (p Participant) matches(q string) bool {
+	if q == "" {
+		return true
+	}
+	q = strings.ToLower(q)
+	for _, s := range []string{p.FirstName + " " + p.LastName, p.Username, p.Phone} {
+		if strings.Contains(strings.ToLower(s), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParticipantIterator iterates over participants of the chat or channel.
+type ParticipantIterator struct {
+	iter *participants.Iterator // supergroups and channels
+
+	buf []Participant // basic chats
+	idx int
+
+	cur Participant
+	err error
+}
+
+// IterParticipants returns the iterator over participants of the chat or
+// channel dlg, that satisfy the filter.
+func (c *Client) IterParticipants(ctx context.Context, dlg Entity, filter ParticipantFilter) (*ParticipantIterator, error) {
+	switch peer := dlg.(type) {
+	case *tg.Chat:
+		pp, err := c.chatParticipants(ctx, peer)
+		if err != nil {
+			return nil, err
+		}
+		var buf []Participant
+		for _, p := range pp {
+			if filter.chat == nil || filter.chat(p) {
+				buf = append(buf, p)
+			}
+		}
+		return &ParticipantIterator{buf: buf, idx: -1}, nil
+	case *tg.Channel:
+		bld := participants.NewQueryBuilder(c.api()).
+			GetParticipants(peer.AsInput()).
+			BatchSize(defBatchSize)
+		if filter.channel != nil {
+			bld = bld.Filter(filter.channel)
+		}
+		return &ParticipantIterator{iter: bld.Iter()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+}
+
+// Next advances the iterator, it returns false when there are no more
+// participants or an error occurred.
+func (it *ParticipantIterator) Next(ctx context.Context) bool {
+	if it.iter == nil {
+		it.idx++
+		if it.idx >= len(it.buf) {
+			return false
+		}
+		it.cur = it.buf[it.idx]
+		return true
+	}
+	for it.iter.Next(ctx) {
+		p, ok := fromChannelParticipant(it.iter.Value())
+		if !ok {
+			continue
+		}
+		it.cur = p
+		return true
+	}
+	it.err = it.iter.Err()
+	return false
+}
+
+// Value returns the current participant.
+func (it *ParticipantIterator) Value() Participant {
+	return it.cur
+}
+
+// Err returns the iteration error, if any.
+func (it *ParticipantIterator) Err() error {
+	return it.err
+}
+
+// GetParticipants returns all participants of the chat or channel dlg, that
+// satisfy the filter.
+func (c *Client) GetParticipants(ctx context.Context, dlg Entity, filter ParticipantFilter) ([]Participant, error) {
+	it, err := c.IterParticipants(ctx, dlg, filter)
+	if err != nil {
+		return nil, err
+	}
+	var pp []Participant
+	for it.Next(ctx) {
+		pp = append(pp, it.Value())
+	}
+	return pp, it.Err()
+}
+
+// chatParticipants returns participants of the basic chat.
+func (c *Client) chatParticipants(ctx context.Context, chat *tg.Chat) ([]Participant, error) {
+	resp, err := c.api().MessagesGetFullChat(ctx, chat.ID)
+	if err != nil {
+		return nil, err
+	}
+	full, ok := resp.FullChat.(*tg.ChatFull)
+	if !ok {
+		return nil, fmt.Errorf("unexpected full chat type: %T", resp.FullChat)
+	}
+	cp, ok := full.Participants.(*tg.ChatParticipants)
+	if !ok {
+		return nil, ErrNoParticipants
+	}
+	users := tg.UserClassArray(resp.Users).UserToMap()
+
+	var pp = make([]Participant, 0, len(cp.Participants))
+	for _, part := range cp.Participants {
+		p := fromChatParticipant(part)
+		p.setUser(users[p.UserID])
+		pp = append(pp, p)
+	}
+	return pp, nil
+}
+
+func fromChatParticipant(part tg.ChatParticipantClass) Participant {
+	switch v := part.(type) {
+	case *tg.ChatParticipantCreator:
+		return Participant{UserID: v.UserID, Role: RoleCreator}
+	case *tg.ChatParticipantAdmin:
+		return Participant{UserID: v.UserID, Role: RoleAdmin, InviterID: v.InviterID, Date: unixTimePtr(v.Date)}
+	case *tg.ChatParticipant:
+		return Participant{UserID: v.UserID, Role: RoleMember, InviterID: v.InviterID, Date: unixTimePtr(v.Date)}
+	default:
+		return Participant{UserID: part.GetUserID(), Role: RoleMember}
+	}
+}
+
+// fromChannelParticipant converts the channel participant to Participant.  It
+// returns false, if the participant is not a user.
+func fromChannelParticipant(e participants.Elem) (Participant, bool) {
+	var p Participant
+	switch v := e.Participant.(type) {
+	case *tg.ChannelParticipant:
+		p = Participant{UserID: v.UserID, Role: RoleMember, Date: unixTimePtr(v.Date)}
+	case *tg.ChannelParticipantSelf:
+		p = Participant{UserID: v.UserID, Role: RoleMember, InviterID: v.InviterID, Date: unixTimePtr(v.Date)}
+	case *tg.ChannelParticipantCreator:
+		p = Participant{UserID: v.UserID, Role: RoleCreator, Rank: v.Rank}
+	case *tg.ChannelParticipantAdmin:
+		p = Participant{UserID: v.UserID, Role: RoleAdmin, Rank: v.Rank, InviterID: v.InviterID, Date: unixTimePtr(v.Date)}
+	case *tg.ChannelParticipantBanned:
+		pu, ok := v.Peer.(*tg.PeerUser)
+		if !ok {
+			return Participant{}, false
+		}
+		p = Participant{UserID: pu.UserID, Role: RoleBanned, Date: unixTimePtr(v.Date)}
+	case *tg.ChannelParticipantLeft:
+		pu, ok := v.Peer.(*tg.PeerUser)
+		if !ok {
+			return Participant{}, false
+		}
+		p = Participant{UserID: pu.UserID, Role: RoleLeft}
+	default:
+		return Participant{}, false
+	}
+	if u, ok := e.User(); ok {
+		p.setUser(u)
+	}
+	return p, true
+}
+
+// unixDate converts the time to the unix timestamp, the zero time to 0, which
+// means "not set" to the API.
+func unixDate(t time.Time) int {
+	if t.IsZero() {
+		return 0
+	}
+	return int(t.Unix())
+}
+
+func unixTime(ts int) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(ts), 0)
+}
+
+// unixTimePtr is unixTime, that returns nil for the zero timestamp.
+func unixTimePtr(ts int) *time.Time {
+	if ts == 0 {
+		return nil
+	}
+	t := time.Unix(int64(ts), 0)
+	return &t
+}
+
+// ExportFormat is the format of the export file.
+type ExportFormat int
+
+const (
+	ExportCSV   ExportFormat = iota // comma separated values with header
+	ExportJSONL                     // one JSON object per line
+)
+
+// ExportParticipants writes the participants of the chat or channel dlg, that
+// satisfy the filter, to w in the format.  It returns the number of
+// participants written.
+func (c *Client) ExportParticipants(ctx context.Context, w io.Writer, dlg Entity, filter ParticipantFilter, format ExportFormat) (int, error) {
+	it, err := c.IterParticipants(ctx, dlg, filter)
+	if err != nil {
+		return 0, err
+	}
+	return writeParticipants(ctx, w, it, format)
+}
+
+var participantCSVHeader = []string{"user_id", "username", "first_name", "last_name", "phone", "bot", "role", "rank", "inviter_id", "date"}
+
+// writeParticipants writes all participants from the iterator to w.
+func writeParticipants(ctx context.Context, w io.Writer, it *ParticipantIterator, format ExportFormat) (int, error) {
+	var (
+		write func(Participant) error
+		flush func() error
+	)
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(participantCSVHeader); err != nil {
+			return 0, err
+		}
+		write = func(p Participant) error { return cw.Write(p.record()) }
+		flush = func() error { cw.Flush(); return cw.Error() }
+	case ExportJSONL:
+		enc := json.NewEncoder(w)
+		write = func(p Participant) error { return enc.Encode(p) }
+		flush = func() error { return nil }
+	default:
+		return 0, fmt.Errorf("unsupported export format: %d", format)
+	}
+
+	n := 0
+	for it.Next(ctx) {
+		if err := write(it.Value()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+// record returns the CSV record for the participant.
+func (p Participant) record() []string {
+	var date string
+	if p.Date != nil {
+		date = p.Date.UTC().Format(time.RFC3339)
+	}
+	var inviter string
+	if p.InviterID != 0 {
+		inviter = strconv.FormatInt(p.InviterID, 10)
+	}
+	return []string{
+		strconv.FormatInt(p.UserID, 10),
+		p.Username,
+		p.FirstName,
+		p.LastName,
+		p.Phone,
+		strconv.FormatBool(p.Bot),
+		string(p.Role),
+		p.Rank,
+		inviter,
+		date,
+	}
+}
@@ -0,0 +1,88 @@
+package mtpwrap
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParticipant_matches(t *testing.T) {
+	p := Participant{FirstName: "John", LastName: "Smith", Username: "jsmith", Phone: "6422123456"}
+	tests := []struct {
+		name string
+		q    string
+		want bool
+	}{
+		{"empty query", "", true},
+		{"full name", "john smith", true},
+		{"username", "JSMITH", true},
+		{"phone", "22123", true},
+		{"no match", "doe", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.matches(tt.q))
+		})
+	}
+}
+
+func Test_writeParticipants(t *testing.T) {
+	joined := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var testParticipants = []Participant{
+		{UserID: 1, Username: "creator", FirstName: "Ann", Role: RoleCreator},
+		{UserID: 2, FirstName: "Bob", LastName: "Lee", Role: RoleMember, InviterID: 1, Date: &joined},
+	}
+	tests := []struct {
+		name    string
+		format  ExportFormat
+		want    string
+		wantErr bool
+	}{
+		{
+			"csv",
+			ExportCSV,
+			"user_id,username,first_name,last_name,phone,bot,role,rank,inviter_id,date\n" +
+				"1,creator,Ann,,,false,creator,,,\n" +
+				"2,,Bob,Lee,,false,member,,1,2024-01-02T03:04:05Z\n",
+			false,
+		},
+		{
+			"jsonl",
+			ExportJSONL,
+			`{"user_id":1,"username":"creator","first_name":"Ann","role":"creator"}` + "\n" +
+				`{"user_id":2,"first_name":"Bob","last_name":"Lee","role":"member","inviter_id":1,"date":"2024-01-02T03:04:05Z"}` + "\n",
+			false,
+		},
+		{
+			"unsupported",
+			ExportFormat(42),
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			it := &ParticipantIterator{buf: testParticipants, idx: -1}
+			n, err := writeParticipants(context.Background(), &buf, it, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("writeParticipants() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, len(testParticipants), n)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func Test_unixDate(t *testing.T) {
+	assert.Equal(t, 0, unixDate(time.Time{}))
+	assert.Equal(t, 1700000000, unixDate(time.Unix(1700000000, 0)))
+	assert.Equal(t, 1700000000, unixDate(unixTime(1700000000)))
+}
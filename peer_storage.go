@@ -2,31 +2,59 @@ package mtpwrap
 
 import (
 	"context"
-	"errors"
 	"sort"
+	"strings"
 	"sync"
+	"unicode"
 
 	"github.com/gotd/contrib/storage"
 )
 
+// PeerIndex is implemented by the peer storages, that are able to look up
+// peers by username, phone and title without iterating over all peers.  All
+// lookups are case-insensitive, and return storage.ErrPeerNotFound if there's
+// no match.
+type PeerIndex interface {
+	// FindByUsername returns the user or channel with the username.  The
+	// username may have the leading "@".
+	FindByUsername(ctx context.Context, username string) (storage.Peer, error)
+	// FindByPhone returns the user with the phone number.
+	FindByPhone(ctx context.Context, phone string) (storage.Peer, error)
+	// FindByTitle returns the peers, which titles (or full names for users)
+	// are equal to the title, ignoring case and repeating whitespace.
+	FindByTitle(ctx context.Context, title string) ([]storage.Peer, error)
+}
+
 // MemStorage is the default peer storage for MTP. It uses a map to store all
-// peers, hence, it's not a persistent store.
+// peers, hence, it's not a persistent store.  It is safe for concurrent use,
+// each iterator works on its own snapshot of the storage, so the storage can
+// be modified while iterating.
 type MemStorage struct {
-	s map[string]storage.Peer
+	mu sync.RWMutex
+	s  map[string]storage.Peer
 
-	mu        sync.RWMutex
-	iterating bool
+	// secondary indexes, values are keys in s.
+	byUsername map[string]string
+	byPhone    map[string]string
+	byTitle    map[string]map[string]struct{}
 
-	// iterator
-	keys   []string
-	keyIdx int
-
-	iterErr error
+	// it is the latest iterator returned by Iterate, it's used by the
+	// deprecated iterator methods of the storage.
+	itMu sync.Mutex
+	it   *memIterator
 }
 
+var (
+	_ PeerIndex            = (*MemStorage)(nil)
+	_ storage.PeerIterator = (*MemStorage)(nil) // deprecated iterator methods
+)
+
 func NewMemStorage() *MemStorage {
 	return &MemStorage{
-		s: make(map[string]storage.Peer, 0),
+		s:          make(map[string]storage.Peer, 0),
+		byUsername: make(map[string]string),
+		byPhone:    make(map[string]string),
+		byTitle:    make(map[string]map[string]struct{}),
 	}
 }
 
@@ -34,8 +62,7 @@ func (ms *MemStorage) Add(_ context.Context, value storage.Peer) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	key := storage.KeyFromPeer(value).String()
-	ms.s[key] = value
+	ms.set(storage.KeyFromPeer(value).String(), value)
 	return nil
 }
 
@@ -47,11 +74,181 @@ func (ms *MemStorage) Assign(_ context.Context, key string, value storage.Peer)
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	ms.s[key] = value
+	ms.set(key, value)
 
 	return nil
 }
 
+// set stores the peer under the key and updates the indexes.  Caller must
+// hold the write lock.
+func (ms *MemStorage) set(key string, value storage.Peer) {
+	if old, ok := ms.s[key]; ok {
+		ms.unindex(key, old)
+	}
+	ms.s[key] = value
+	ms.index(key, value)
+}
+
+func (ms *MemStorage) index(key string, p storage.Peer) {
+	for _, u := range peerUsernames(p) {
+		ms.byUsername[u] = key
+	}
+	if ph := peerPhone(p); ph != "" {
+		ms.byPhone[ph] = key
+	}
+	if t := peerTitle(p); t != "" {
+		keys, ok := ms.byTitle[t]
+		if !ok {
+			keys = make(map[string]struct{}, 1)
+			ms.byTitle[t] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (ms *MemStorage) unindex(key string, p storage.Peer) {
+	for _, u := range peerUsernames(p) {
+		if ms.byUsername[u] == key {
+			delete(ms.byUsername, u)
+		}
+	}
+	if ph := peerPhone(p); ph != "" && ms.byPhone[ph] == key {
+		delete(ms.byPhone, ph)
+	}
+	if t := peerTitle(p); t != "" {
+		delete(ms.byTitle[t], key)
+		if len(ms.byTitle[t]) == 0 {
+			delete(ms.byTitle, t)
+		}
+	}
+}
+
+// FindByUsername implements PeerIndex.
+func (ms *MemStorage) FindByUsername(_ context.Context, username string) (storage.Peer, error) {
+	return ms.lookup(ms.byUsername, NormalizeUsername(username))
+}
+
+// FindByPhone implements PeerIndex.
+func (ms *MemStorage) FindByPhone(_ context.Context, phone string) (storage.Peer, error) {
+	return ms.lookup(ms.byPhone, normalizePhone(phone))
+}
+
+func (ms *MemStorage) lookup(idx map[string]string, s string) (storage.Peer, error) {
+	if s == "" {
+		return storage.Peer{}, storage.ErrPeerNotFound
+	}
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	key, ok := idx[s]
+	if !ok {
+		return storage.Peer{}, storage.ErrPeerNotFound
+	}
+	return ms.s[key], nil
+}
+
+// FindByTitle implements PeerIndex.  Peers are sorted by key.
+func (ms *MemStorage) FindByTitle(_ context.Context, title string) ([]storage.Peer, error) {
+	t := NormalizeTitle(title)
+	if t == "" {
+		return nil, storage.ErrPeerNotFound
+	}
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	keys := make([]string, 0, len(ms.byTitle[t]))
+	for k := range ms.byTitle[t] {
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, storage.ErrPeerNotFound
+	}
+	sort.Strings(keys)
+	peers := make([]storage.Peer, len(keys))
+	for i, k := range keys {
+		peers[i] = ms.s[k]
+	}
+	return peers, nil
+}
+
+// NormalizeUsername returns the username in the form used by the indexes:
+// lowercase, without the leading "@" or the t.me link prefix.
+func NormalizeUsername(username string) string {
+	username = strings.TrimSpace(username)
+	for _, prefix := range []string{"https://", "http://", "t.me/", "telegram.me/", "@"} {
+		username = strings.TrimPrefix(username, prefix)
+	}
+	return strings.ToLower(username)
+}
+
+// NormalizeTitle returns the title in the form used by the indexes:
+// lowercase, with whitespace runs replaced by a single space.
+func NormalizeTitle(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// normalizePhone leaves only digits in the phone number.
+func normalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+// peerUsernames returns all normalised usernames of the user or channel,
+// including the collectible ones.
+func peerUsernames(p storage.Peer) []string {
+	var uu []string
+	add := func(u string) {
+		if u = NormalizeUsername(u); u != "" {
+			uu = append(uu, u)
+		}
+	}
+	switch {
+	case p.User != nil:
+		add(p.User.Username)
+		for _, u := range p.User.Usernames {
+			add(u.Username)
+		}
+	case p.Channel != nil:
+		add(p.Channel.Username)
+		for _, u := range p.Channel.Usernames {
+			add(u.Username)
+		}
+	}
+	return uu
+}
+
+func peerPhone(p storage.Peer) string {
+	if p.User == nil {
+		return ""
+	}
+	return normalizePhone(p.User.Phone)
+}
+
+// peerTitle returns the normalised title of the chat or channel, or the full
+// name of the user.
+func peerTitle(p storage.Peer) string {
+	ent, ok := peerEntity(p)
+	if !ok {
+		return ""
+	}
+	return NormalizeTitle(ent.GetTitle())
+}
+
+// peerEntity returns the entity stored in the peer.
+func peerEntity(p storage.Peer) (Entity, bool) {
+	switch {
+	case p.Channel != nil:
+		return p.Channel, true
+	case p.Chat != nil:
+		return p.Chat, true
+	case p.User != nil:
+		return UserEntity{p.User}, true
+	}
+	return nil, false
+}
+
 func (ms *MemStorage) Resolve(_ context.Context, key string) (storage.Peer, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
@@ -63,67 +260,128 @@ func (ms *MemStorage) Resolve(_ context.Context, key string) (storage.Peer, erro
 	return peer, nil
 }
 
+// Iterate returns the iterator over the snapshot of the storage peers, sorted
+// by key.
 func (ms *MemStorage) Iterate(ctx context.Context) (storage.PeerIterator, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
-	if ms.IsIterating() {
-		return nil, errors.New("already iterating")
-	}
 
-	// preparing the iterator
-	ms.mu.Lock()
-	ms.keys = make([]string, 0, len(ms.s))
+	ms.mu.RLock()
+	keys := make([]string, 0, len(ms.s))
 	for k := range ms.s {
-		ms.keys = append(ms.keys, k)
+		keys = append(keys, k)
 	}
-	sort.Strings(ms.keys)
-	ms.keyIdx = -1 // set the passphrase start value
+	sort.Strings(keys)
+	peers := make([]storage.Peer, len(keys))
+	for i, k := range keys {
+		peers[i] = ms.s[k]
+	}
+	ms.mu.RUnlock()
 
-	ms.iterating = true
-	ms.iterErr = nil
-	ms.mu.Unlock()
+	it := &memIterator{peers: peers, idx: -1}
+	ms.itMu.Lock()
+	ms.it = it
+	ms.itMu.Unlock()
+	return it, nil
+}
 
-	// locking for iteration
-	ms.mu.RLock()
-	return ms, nil
+// iter returns the latest iterator returned by Iterate, or nil, if the
+// iteration was closed with Close.
+func (ms *MemStorage) iter() *memIterator {
+	ms.itMu.Lock()
+	defer ms.itMu.Unlock()
+	return ms.it
 }
 
+// Next advances the latest iterator returned by Iterate.
+//
+// Deprecated: use the iterator returned by Iterate.
 func (ms *MemStorage) Next(ctx context.Context) bool {
-	select {
-	case <-ctx.Done():
-		ms.iterErr = ctx.Err()
-		return false
-	default:
+	if it := ms.iter(); it != nil {
+		return it.Next(ctx)
 	}
-	ms.keyIdx++
-	return ms.keyIdx < len(ms.keys)
+	return false
 }
 
+// Err returns the error of the latest iterator returned by Iterate.
+//
+// Deprecated: use the iterator returned by Iterate.
 func (ms *MemStorage) Err() error {
-	return ms.iterErr
+	if it := ms.iter(); it != nil {
+		return it.Err()
+	}
+	return nil
 }
 
+// Value returns the current peer of the latest iterator returned by Iterate.
+//
+// Deprecated: use the iterator returned by Iterate.
 func (ms *MemStorage) Value() storage.Peer {
-	if !ms.IsIterating() {
-		return storage.Peer{}
+	if it := ms.iter(); it != nil {
+		return it.Value()
 	}
-	return ms.s[ms.keys[ms.keyIdx]]
+	return storage.Peer{}
 }
 
+// Close closes the latest iterator returned by Iterate.
+//
+// Deprecated: use the iterator returned by Iterate.
 func (ms *MemStorage) Close() error {
-	if !ms.IsIterating() {
+	ms.itMu.Lock()
+	it := ms.it
+	ms.it = nil
+	ms.itMu.Unlock()
+	if it == nil {
 		return nil
 	}
-	ms.mu.RUnlock()
-	ms.mu.Lock()
-	ms.iterating = false
-	ms.mu.Unlock()
-	return nil
+	return it.Close()
 }
 
+// IsIterating reports whether Iterate was called, and the iteration wasn't
+// closed with Close.
+//
+// Deprecated: iterators returned by Iterate are independent, the storage
+// can be used while iterating.
 func (ms *MemStorage) IsIterating() bool {
-	return ms.iterating
+	return ms.iter() != nil
+}
+
+// memIterator iterates over the snapshot of the MemStorage.
+type memIterator struct {
+	peers []storage.Peer
+	idx   int
+	err   error
+}
+
+func (it *memIterator) Next(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		it.err = ctx.Err()
+		return false
+	default:
+	}
+	if it.idx >= len(it.peers) {
+		return false
+	}
+	it.idx++
+	return it.idx < len(it.peers)
+}
+
+func (it *memIterator) Err() error {
+	return it.err
+}
+
+func (it *memIterator) Value() storage.Peer {
+	if it.idx < 0 || it.idx >= len(it.peers) {
+		return storage.Peer{}
+	}
+	return it.peers[it.idx]
+}
+
+func (it *memIterator) Close() error {
+	it.peers = nil
+	return nil
 }
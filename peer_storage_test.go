@@ -0,0 +1,232 @@
+package mtpwrap
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/bluele/gcache"
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPeer(t *testing.T, id int64) storage.Peer {
+	t.Helper()
+	var p storage.Peer
+	require.True(t, p.FromChat(&tg.Chat{ID: id, Title: "chat"}))
+	return p
+}
+
+func collectIDs(t *testing.T, ctx context.Context, ms *MemStorage) []int64 {
+	t.Helper()
+	it, err := ms.Iterate(ctx)
+	require.NoError(t, err)
+	defer it.Close()
+	var ids []int64
+	for it.Next(ctx) {
+		ids = append(ids, it.Value().Key.ID)
+	}
+	require.NoError(t, it.Err())
+	return ids
+}
+
+func TestMemStorage_Iterate(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+	for _, id := range []int64{3, 1, 2} {
+		require.NoError(t, ms.Add(ctx, testPeer(t, id)))
+	}
+
+	it1, err := ms.Iterate(ctx)
+	require.NoError(t, err)
+	defer it1.Close()
+	require.True(t, it1.Next(ctx))
+
+	// second iterator and modification while iterating.
+	assert.Equal(t, []int64{1, 2, 3}, collectIDs(t, ctx, ms))
+	require.NoError(t, ms.Add(ctx, testPeer(t, 4)))
+
+	// first iterator sees its own snapshot.
+	var ids = []int64{it1.Value().Key.ID}
+	for it1.Next(ctx) {
+		ids = append(ids, it1.Value().Key.ID)
+	}
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+	assert.False(t, it1.Next(ctx), "exhausted iterator must stay exhausted")
+	assert.Equal(t, []int64{1, 2, 3, 4}, collectIDs(t, ctx, ms))
+}
+
+func TestMemStorage_deprecatedIterator(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+	for _, id := range []int64{2, 1} {
+		require.NoError(t, ms.Add(ctx, testPeer(t, id)))
+	}
+	assert.False(t, ms.IsIterating())
+	assert.False(t, ms.Next(ctx))
+
+	_, err := ms.Iterate(ctx)
+	require.NoError(t, err)
+	assert.True(t, ms.IsIterating())
+	var ids []int64
+	for ms.Next(ctx) {
+		ids = append(ids, ms.Value().Key.ID)
+	}
+	assert.NoError(t, ms.Err())
+	assert.Equal(t, []int64{1, 2}, ids)
+
+	assert.NoError(t, ms.Close())
+	assert.False(t, ms.IsIterating())
+	assert.Equal(t, storage.Peer{}, ms.Value())
+}
+
+func TestMemStorage_IterateCancelled(t *testing.T) {
+	ms := NewMemStorage()
+	require.NoError(t, ms.Add(context.Background(), testPeer(t, 1)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	it, err := ms.Iterate(ctx)
+	require.NoError(t, err)
+	cancel()
+	assert.False(t, it.Next(ctx))
+	assert.ErrorIs(t, it.Err(), context.Canceled)
+
+	_, err = ms.Iterate(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestMemStorage_Concurrent(t *testing.T) {
+	const (
+		numWriters = 4
+		numReaders = 4
+		numPeers   = 100
+	)
+	ctx := context.Background()
+	ms := NewMemStorage()
+
+	var wg sync.WaitGroup
+	for w := 0; w < numWriters; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < numPeers; i++ {
+				p := testPeer(t, int64(w*numPeers+i))
+				assert.NoError(t, ms.Add(ctx, p))
+				_, err := ms.Find(ctx, storage.KeyFromPeer(p))
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	for r := 0; r < numReaders; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < numPeers/10; i++ {
+				it, err := ms.Iterate(ctx)
+				if !assert.NoError(t, err) {
+					return
+				}
+				for it.Next(ctx) {
+					// while iterating, the storage must accept writes.
+					assert.NoError(t, ms.Add(ctx, it.Value()))
+				}
+				assert.NoError(t, it.Err())
+				it.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, collectIDs(t, ctx, ms), numWriters*numPeers)
+}
+
+func TestClient_GetEntitiesConcurrent(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+	for i := int64(1); i <= 10; i++ {
+		require.NoError(t, ms.Add(ctx, testPeer(t, i)))
+	}
+	cache := gcache.New(defCacheSz).LFU().Build()
+	require.NoError(t, cache.Set(cacheDlgStorage, true)) // storage is populated
+	c := &Client{peerStrg: ms, cache: cache}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ents, err := c.GetChats(ctx)
+			assert.NoError(t, err)
+			assert.Len(t, ents, 10)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMemStorage_Index(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+
+	var user, channel, chat storage.Peer
+	require.True(t, user.FromUser(&tg.User{ID: 1, AccessHash: 10, Username: "Durov", FirstName: "Pavel", LastName: "Durov", Phone: "+7 (900) 123"}))
+	require.True(t, channel.FromChat(&tg.Channel{ID: 2, AccessHash: 20, Title: "Test  Channel", Username: "testchan", Usernames: []tg.Username{{Username: "altname", Active: true}}}))
+	require.True(t, chat.FromChat(&tg.Chat{ID: 3, Title: "test channel"}))
+	for _, p := range []storage.Peer{user, channel, chat} {
+		require.NoError(t, ms.Add(ctx, p))
+	}
+
+	got, err := ms.FindByUsername(ctx, "@durov")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), got.Key.ID)
+	got, err = ms.FindByUsername(ctx, "https://t.me/AltName")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), got.Key.ID)
+	_, err = ms.FindByUsername(ctx, "nobody")
+	assert.ErrorIs(t, err, storage.ErrPeerNotFound)
+
+	got, err = ms.FindByPhone(ctx, "7900123")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), got.Key.ID)
+
+	peers, err := ms.FindByTitle(ctx, " TEST channel ")
+	require.NoError(t, err)
+	require.Len(t, peers, 2)
+	peers, err = ms.FindByTitle(ctx, "pavel durov")
+	require.NoError(t, err)
+	require.Len(t, peers, 1)
+	assert.Equal(t, int64(1), peers[0].Key.ID)
+
+	// updating the peer must drop the stale index entries.
+	require.True(t, channel.FromChat(&tg.Channel{ID: 2, AccessHash: 20, Title: "Renamed", Username: "newchan"}))
+	require.NoError(t, ms.Add(ctx, channel))
+	_, err = ms.FindByUsername(ctx, "testchan")
+	assert.ErrorIs(t, err, storage.ErrPeerNotFound)
+	_, err = ms.FindByUsername(ctx, "altname")
+	assert.ErrorIs(t, err, storage.ErrPeerNotFound)
+	peers, err = ms.FindByTitle(ctx, "test channel")
+	require.NoError(t, err)
+	assert.Len(t, peers, 1)
+	got, err = ms.FindByUsername(ctx, "newchan")
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", got.Channel.Title)
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"durov", "durov"},
+		{"@Durov", "durov"},
+		{" t.me/durov ", "durov"},
+		{"https://t.me/durov", "durov"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			assert.Equal(t, tt.want, NormalizeUsername(tt.in))
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package mtpwrap
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gotd/td/telegram/dcs"
+	"golang.org/x/net/proxy"
+)
+
+// EnvProxy is the environment variable with the proxy URL, see
+// ParseProxyURL.
+const EnvProxy = "MTPWRAP_PROXY"
+
+// ProxyType is the type of the proxy.
+type ProxyType int
+
+const (
+	ProxySOCKS5 ProxyType = iota + 1
+	ProxyMTProto
+)
+
+func (t ProxyType) String() string {
+	switch t {
+	case ProxySOCKS5:
+		return "socks5"
+	case ProxyMTProto:
+		return "mtproto"
+	default:
+		return fmt.Sprintf("ProxyType(%d)", int(t))
+	}
+}
+
+// Proxy is the proxy configuration.
+type Proxy struct {
+	Type ProxyType
+	// Addr is the proxy address in the host:port form.
+	Addr string
+	// User and Password are the SOCKS5 credentials, optional.
+	User     string
+	Password string
+	// Secret is the MTProxy secret.
+	Secret []byte
+}
+
+// String returns the proxy URL, without the credentials and the secret.
+func (p Proxy) String() string {
+	return p.Type.String() + "://" + p.Addr
+}
+
+func (p Proxy) validate() error {
+	if _, _, err := net.SplitHostPort(p.Addr); err != nil {
+		return fmt.Errorf("invalid proxy address: %w", err)
+	}
+	switch p.Type {
+	case ProxySOCKS5:
+	case ProxyMTProto:
+		if len(p.Secret) == 0 {
+			return errors.New("MTProxy secret is required")
+		}
+	default:
+		return fmt.Errorf("unsupported proxy type: %s", p.Type)
+	}
+	return nil
+}
+
+// resolver returns the telegram DC resolver, that connects through the proxy.
+func (p Proxy) resolver() (dcs.Resolver, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	switch p.Type {
+	case ProxySOCKS5:
+		var auth *proxy.Auth
+		if p.User != "" || p.Password != "" {
+			auth = &proxy.Auth{User: p.User, Password: p.Password}
+		}
+		d, err := proxy.SOCKS5("tcp", p.Addr, auth, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		cd, ok := d.(proxy.ContextDialer)
+		if !ok {
+			return nil, errors.New("SOCKS5 dialer does not support context")
+		}
+		return dcs.Plain(dcs.PlainOptions{Dial: cd.DialContext}), nil
+	case ProxyMTProto:
+		return dcs.MTProxy(p.Addr, p.Secret, dcs.MTProxyOptions{})
+	default:
+		return nil, fmt.Errorf("unsupported proxy type: %s", p.Type)
+	}
+}
+
+// WithSOCKS5Proxy sets the SOCKS5 proxy at addr (host:port).  user and
+// password are optional.
+func WithSOCKS5Proxy(addr, user, password string) Option {
+	return func(c *Client) {
+		c.proxy = &Proxy{Type: ProxySOCKS5, Addr: addr, User: user, Password: password}
+	}
+}
+
+// WithMTProxy sets the MTProxy at addr (host:port).  The secret is in hex or
+// base64 encoding, as in the proxy links.  Invalid secret is reported by New.
+func WithMTProxy(addr string, secret string) Option {
+	return func(c *Client) {
+		b, err := decodeSecret(secret)
+		if err != nil {
+			c.optErr = errors.Join(c.optErr, err)
+			return
+		}
+		c.proxy = &Proxy{Type: ProxyMTProto, Addr: addr, Secret: b}
+	}
+}
+
+// WithProxy sets the proxy.  nil removes the proxy, set by the previous
+// options.
+func WithProxy(p *Proxy) Option {
+	return func(c *Client) {
+		c.proxy = p
+	}
+}
+
+// WithProxyURL sets the proxy from the URL, see ParseProxyURL.  Empty URL is
+// ignored.  Invalid URL is reported by New.
+func WithProxyURL(link string) Option {
+	return func(c *Client) {
+		if link == "" {
+			return
+		}
+		p, err := ParseProxyURL(link)
+		if err != nil {
+			c.optErr = errors.Join(c.optErr, err)
+			return
+		}
+		c.proxy = &p
+	}
+}
+
+// WithProxyFromEnv sets the proxy from the environment, see
+// ProxyFromEnvironment.  If the environment has no proxy configured, the
+// option has no effect.
+func WithProxyFromEnv() Option {
+	return func(c *Client) {
+		p, err := ProxyFromEnvironment()
+		if err != nil {
+			c.optErr = errors.Join(c.optErr, err)
+			return
+		}
+		if p != nil {
+			c.proxy = p
+		}
+	}
+}
+
+// ProxyFromEnvironment returns the proxy from the MTPWRAP_PROXY environment
+// variable, or, if it's not set, from ALL_PROXY (or all_proxy), if it's a
+// SOCKS5 proxy.  It returns nil, if no proxy is configured.
+func ProxyFromEnvironment() (*Proxy, error) {
+	if v := os.Getenv(EnvProxy); v != "" {
+		p, err := ParseProxyURL(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", EnvProxy, err)
+		}
+		return &p, nil
+	}
+	for _, name := range []string{"ALL_PROXY", "all_proxy"} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		u, err := url.Parse(v)
+		if err != nil || !isSOCKS5Scheme(u.Scheme) {
+			// not usable for telegram, i.e. http proxy.
+			return nil, nil
+		}
+		p, err := ParseProxyURL(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return &p, nil
+	}
+	return nil, nil
+}
+
+func isSOCKS5Scheme(s string) bool {
+	return s == "socks5" || s == "socks5h"
+}
+
+// ParseProxyURL parses the proxy URL, which is one of:
+//
+//   - tg://proxy?server=host&port=443&secret=... (MTProxy link);
+//   - tg://socks?server=host&port=1080&user=...&pass=... (SOCKS5 link);
+//   - https://t.me/proxy?... and https://t.me/socks?..., same as above;
+//   - socks5://[user:password@]host:port.
+func ParseProxyURL(link string) (Proxy, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return Proxy{}, err
+	}
+	var kind string
+	switch {
+	case isSOCKS5Scheme(u.Scheme):
+		p := Proxy{Type: ProxySOCKS5, Addr: u.Host}
+		if u.User != nil {
+			p.User = u.User.Username()
+			p.Password, _ = u.User.Password()
+		}
+		return p, p.validate()
+	case u.Scheme == "tg":
+		kind = u.Host // tg://proxy?...
+		if kind == "" {
+			kind = strings.TrimPrefix(u.Opaque, "//") // tg:proxy?...
+		}
+	case (u.Scheme == "https" || u.Scheme == "http") && (u.Host == "t.me" || u.Host == "telegram.me"):
+		kind = strings.Trim(u.Path, "/")
+	default:
+		return Proxy{}, fmt.Errorf("unsupported proxy URL: %s", u.Redacted())
+	}
+
+	q := u.Query()
+	server, port := q.Get("server"), q.Get("port")
+	if server == "" || port == "" {
+		return Proxy{}, errors.New("proxy link must have server and port")
+	}
+	p := Proxy{Addr: net.JoinHostPort(server, port)}
+	switch kind {
+	case "proxy":
+		p.Type = ProxyMTProto
+		p.Secret, err = decodeSecret(q.Get("secret"))
+		if err != nil {
+			return Proxy{}, err
+		}
+	case "socks":
+		p.Type = ProxySOCKS5
+		p.User, p.Password = q.Get("user"), q.Get("pass")
+	default:
+		return Proxy{}, fmt.Errorf("unsupported proxy link type: %q", kind)
+	}
+	return p, p.validate()
+}
+
+// decodeSecret decodes the MTProxy secret, which is hex or base64 encoded.
+func decodeSecret(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("MTProxy secret is required")
+	}
+	if b, err := hex.DecodeString(s); err == nil {
+		return b, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.RawURLEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.StdEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("invalid MTProxy secret: must be hex or base64 encoded")
+}
@@ -0,0 +1,147 @@
+package mtpwrap
+
+import (
+	"context"
+	"runtime/trace"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/query/messages"
+)
+
+const defPurgeConcurrency = 2
+
+// PurgeOptions are the parameters of the Purge operation.
+type PurgeOptions struct {
+	// After and Before limit the date of messages to delete, After is
+	// inclusive, Before is exclusive.  Zero values mean "unbounded".
+	After  time.Time
+	Before time.Time
+	// Concurrency is the maximum number of dialogs processed at the same
+	// time.  If zero, defaults to 2.
+	Concurrency int
+	// DryRun if set, messages are searched, but not deleted.
+	DryRun bool
+}
+
+// PurgeResult is the result of purging one dialog.
+type PurgeResult struct {
+	Dialog  Entity
+	Found   int   // number of own messages, that satisfy the date bounds
+	Deleted int   // number of messages deleted
+	Err     error // error, if the dialog was not purged completely
+}
+
+// Purge deletes the current user messages in all dialogs, selected by
+// filterFn, within the date bounds of opts.  All own messages of the dialog
+// are fetched, and the date bounds are applied locally.  Dialogs are
+// processed concurrently, if telegram asks to wait (FLOOD_WAIT), the request
+// is retried by the client flood waiter after the requested delay.  It
+// returns the result for each dialog, in the order dialogs were selected.
+// The error is returned only if dialogs can't be listed or ctx is cancelled,
+// errors for the individual dialogs are in the results.
+func (c *Client) Purge(ctx context.Context, filterFn FilterFunc, opts PurgeOptions) ([]PurgeResult, error) {
+	ctx, task := trace.NewTask(ctx, "Purge")
+	defer task.End()
+
+	dlgs, err := c.GetEntities(ctx, filterFn)
+	if err != nil {
+		return nil, err
+	}
+	trace.Logf(ctx, "logic", "dialogs: %d", len(dlgs))
+	sel := func(msgs []messages.Elem) []messages.Elem {
+		return filterByDate(msgs, opts.After, opts.Before)
+	}
+	results := purge(ctx, dlgs, opts.Concurrency, func(ctx context.Context, dlg Entity) PurgeResult {
+		return c.purgeDialog(ctx, dlg, sel, opts.DryRun, "purge")
+	})
+	return results, ctx.Err()
+}
+
+// purgeDialog deletes own messages in one dialog, that are returned by sel.
+// The log messages are prefixed with the prefix.
+func (c *Client) purgeDialog(ctx context.Context, dlg Entity, sel func([]messages.Elem) []messages.Elem, dryRun bool, prefix string) PurgeResult {
+	res := PurgeResult{Dialog: dlg}
+
+	msgs, err := c.SearchAllMyMessages(ctx, dlg, nil)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	msgs = sel(msgs)
+	res.Found = len(msgs)
+	if dryRun || len(msgs) == 0 {
+		Log.Printf("%s: %q: found %d messages", prefix, dlg.GetTitle(), res.Found)
+		return res
+	}
+	Log.Printf("%s: %q: deleting messages: %v", prefix, dlg.GetTitle(), messageIDs(msgs))
+
+	res.Deleted, res.Err = c.DeleteMessages(ctx, dlg, msgs)
+	if res.Err != nil {
+		Log.Printf("%s: %q: error deleting messages: %s", prefix, dlg.GetTitle(), res.Err)
+	}
+	Log.Printf("%s: %q: found %d, deleted %d messages", prefix, dlg.GetTitle(), res.Found, res.Deleted)
+	return res
+}
+
+// purge calls fn for each dialog, running at most n calls concurrently, and
+// returns the results in the order of dialogs.  Dialogs not processed due to
+// ctx cancellation have the context error in the result.
+func purge(ctx context.Context, dlgs []Entity, n int, fn func(context.Context, Entity) PurgeResult) []PurgeResult {
+	if n <= 0 {
+		n = defPurgeConcurrency
+	}
+	var (
+		results = make([]PurgeResult, len(dlgs))
+		sem     = make(chan struct{}, n)
+		wg      sync.WaitGroup
+	)
+	for i, dlg := range dlgs {
+		if err := ctx.Err(); err != nil {
+			results[i] = PurgeResult{Dialog: dlg, Err: err}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			results[i] = PurgeResult{Dialog: dlg, Err: ctx.Err()}
+			continue
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(i int, dlg Entity) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = fn(ctx, dlg)
+		}(i, dlg)
+	}
+	wg.Wait()
+	return results
+}
+
+// filterByDate returns the messages within the date bounds, After is
+// inclusive, Before is exclusive, zero values mean "unbounded".
+func filterByDate(msgs []messages.Elem, after, before time.Time) []messages.Elem {
+	if after.IsZero() && before.IsZero() {
+		return msgs
+	}
+	var out []messages.Elem
+	for _, m := range msgs {
+		date := unixTime(m.Msg.GetDate())
+		if !after.IsZero() && date.Before(after) {
+			continue
+		}
+		if !before.IsZero() && !date.Before(before) {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func messageIDs(msgs []messages.Elem) []int {
+	ids := make([]int, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.Msg.GetID()
+	}
+	return ids
+}
@@ -0,0 +1,96 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_purge(t *testing.T) {
+	var dlgs []Entity
+	for i := int64(1); i <= 10; i++ {
+		dlgs = append(dlgs, &tg.Chat{ID: i})
+	}
+
+	var running, maxRunning int32
+	results := purge(context.Background(), dlgs, 3, func(ctx context.Context, dlg Entity) PurgeResult {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return PurgeResult{Dialog: dlg, Found: int(dlg.GetID())}
+	})
+
+	assert.LessOrEqual(t, maxRunning, int32(3))
+	for i, r := range results {
+		assert.Equal(t, dlgs[i], r.Dialog, "results must be in the order of dialogs")
+		assert.Equal(t, i+1, r.Found)
+	}
+}
+
+func Test_purgeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := purge(ctx, []Entity{&tg.Chat{ID: 1}}, 1, func(ctx context.Context, dlg Entity) PurgeResult {
+		t.Error("must not be called")
+		return PurgeResult{}
+	})
+	assert.ErrorIs(t, results[0].Err, context.Canceled)
+}
+
+func Test_filterByDate(t *testing.T) {
+	var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	msgs := []messages.Elem{
+		{Msg: &tg.Message{ID: 1, Date: int(base.Unix())}},
+		{Msg: &tg.Message{ID: 2, Date: int(base.Add(time.Hour).Unix())}},
+		{Msg: &tg.Message{ID: 3, Date: int(base.Add(2 * time.Hour).Unix())}},
+	}
+	ids := func(mm []messages.Elem) []int {
+		var out []int
+		for _, m := range mm {
+			out = append(out, m.Msg.GetID())
+		}
+		return out
+	}
+	assert.Equal(t, []int{1, 2, 3}, ids(filterByDate(msgs, time.Time{}, time.Time{})))
+	assert.Equal(t, []int{2, 3}, ids(filterByDate(msgs, base.Add(time.Hour), time.Time{})))
+	assert.Equal(t, []int{1}, ids(filterByDate(msgs, time.Time{}, base.Add(time.Hour))))
+	assert.Equal(t, []int{2}, ids(filterByDate(msgs, base.Add(time.Minute), base.Add(2*time.Hour))))
+}
+
+func TestClient_DeleteMessages_partial(t *testing.T) {
+	floodErr := tgerr.New(420, "FLOOD_WAIT_60")
+	msgs := make([]messages.Elem, defBatchSize+1)
+	for i := range msgs {
+		msgs[i] = messages.Elem{Msg: &tg.Message{ID: i + 1}}
+	}
+	var calls int
+	c := newFakeAPIClient(t, func(_ context.Context, req bin.Encoder) (bin.Encoder, error) {
+		del, ok := req.(*tg.MessagesDeleteMessagesRequest)
+		if !ok {
+			return nil, errors.New("unexpected request")
+		}
+		calls++
+		if calls > 1 {
+			return nil, floodErr
+		}
+		return &tg.MessagesAffectedMessages{PtsCount: len(del.ID)}, nil
+	})
+	n, err := c.DeleteMessages(context.Background(), &tg.Chat{ID: 1}, msgs)
+	assert.ErrorIs(t, err, floodErr)
+	assert.Equal(t, defBatchSize, n, "messages deleted before the error must be counted")
+	assert.Equal(t, 2, calls)
+}
@@ -3,6 +3,10 @@ package mtpwrap
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gotd/td/tg"
 )
@@ -11,7 +15,7 @@ var ErrNoChannelReactions = errors.New("no channel reactions")
 
 // ChannelReactions returns available channel reactions.
 func (cl *Client) ChannelReactions(ctx context.Context, channel tg.InputChannelClass) (tg.ChatReactionsClass, error) {
-	mcf, err := cl.cl.API().ChannelsGetFullChannel(ctx, channel)
+	mcf, err := cl.api().ChannelsGetFullChannel(ctx, channel)
 	if err != nil {
 		return nil, err
 	}
@@ -21,3 +25,186 @@ func (cl *Client) ChannelReactions(ctx context.Context, channel tg.InputChannelC
 	}
 	return ar, nil
 }
+
+// ChatReactions returns available reactions for the chat or channel dlg.
+func (c *Client) ChatReactions(ctx context.Context, dlg Entity) (tg.ChatReactionsClass, error) {
+	switch peer := dlg.(type) {
+	case *tg.Channel:
+		return c.ChannelReactions(ctx, peer.AsInput())
+	case *tg.Chat:
+		mcf, err := c.api().MessagesGetFullChat(ctx, peer.ID)
+		if err != nil {
+			return nil, err
+		}
+		ar, ok := mcf.FullChat.GetAvailableReactions()
+		if !ok {
+			return nil, ErrNoChannelReactions
+		}
+		return ar, nil
+	default:
+		return nil, fmt.Errorf("unsupported input peer type: %T", peer)
+	}
+}
+
+// SendReaction sets the reactions of the current user on the message msgID
+// in the chat or channel dlg.  Reactions are emoticons, or custom emoji in
+// "custom:<document id>" format (see ReactionKey).  Calling it without
+// reactions removes the user's reactions from the message.
+func (c *Client) SendReaction(ctx context.Context, dlg Entity, msgID int, reactions ...string) error {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return err
+	}
+	var rr = make([]tg.ReactionClass, 0, len(reactions))
+	for _, r := range reactions {
+		rc, err := ParseReaction(r)
+		if err != nil {
+			return err
+		}
+		rr = append(rr, rc)
+	}
+	_, err = c.api().MessagesSendReaction(ctx, &tg.MessagesSendReactionRequest{
+		Peer:     ip,
+		MsgID:    msgID,
+		Reaction: rr,
+	})
+	return err
+}
+
+// RemoveReaction removes the reactions of the current user from the message.
+func (c *Client) RemoveReaction(ctx context.Context, dlg Entity, msgID int) error {
+	return c.SendReaction(ctx, dlg, msgID)
+}
+
+// PeerReaction is the reaction of a user or a chat on the message.
+type PeerReaction struct {
+	Peer     tg.PeerClass
+	Reaction string
+	Date     time.Time
+	Big      bool
+	My       bool
+
+	// User is the user object, if the peer is a user and it was returned by
+	// the API.
+	User *tg.User
+}
+
+// MessageReactions returns the list of peers that reacted to the message
+// msgID.  If reaction is not empty, only peers that reacted with it are
+// returned.
+func (c *Client) MessageReactions(ctx context.Context, dlg Entity, msgID int, reaction string) ([]PeerReaction, error) {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return nil, err
+	}
+	var req = &tg.MessagesGetMessageReactionsListRequest{
+		Peer:  ip,
+		ID:    msgID,
+		Limit: defBatchSize,
+	}
+	if reaction != "" {
+		rc, err := ParseReaction(reaction)
+		if err != nil {
+			return nil, err
+		}
+		req.Reaction = rc
+	}
+
+	var pr []PeerReaction
+	for {
+		resp, err := c.api().MessagesGetMessageReactionsList(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		users := tg.UserClassArray(resp.Users).UserToMap()
+		for _, r := range resp.Reactions {
+			p := PeerReaction{
+				Peer:     r.PeerID,
+				Reaction: ReactionKey(r.Reaction),
+				Date:     unixTime(r.Date),
+				Big:      r.Big,
+				My:       r.My,
+			}
+			if pu, ok := r.PeerID.(*tg.PeerUser); ok {
+				p.User = users[pu.UserID]
+			}
+			pr = append(pr, p)
+		}
+		if resp.NextOffset == "" || len(resp.Reactions) == 0 {
+			break
+		}
+		req.Offset = resp.NextOffset
+	}
+	return pr, nil
+}
+
+// ReactionCounts returns the total number of each reaction on messages
+// msgIDs in the chat or channel dlg.
+func (c *Client) ReactionCounts(ctx context.Context, dlg Entity, msgIDs []int) (map[string]int, error) {
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return nil, err
+	}
+	var counts = make(map[string]int)
+	for _, chunk := range splitBy(defBatchSize, msgIDs, func(i int) int { return msgIDs[i] }) {
+		resp, err := c.api().MessagesGetMessagesReactions(ctx, &tg.MessagesGetMessagesReactionsRequest{
+			Peer: ip,
+			ID:   chunk,
+		})
+		if err != nil {
+			return nil, err
+		}
+		upd, ok := resp.(*tg.Updates)
+		if !ok {
+			return nil, fmt.Errorf("unexpected updates type: %T", resp)
+		}
+		addReactionCounts(counts, upd.Updates)
+	}
+	return counts, nil
+}
+
+// addReactionCounts adds reaction counts from message reaction updates to
+// counts.
+func addReactionCounts(counts map[string]int, updates []tg.UpdateClass) {
+	for _, u := range updates {
+		mr, ok := u.(*tg.UpdateMessageReactions)
+		if !ok {
+			continue
+		}
+		for _, rc := range mr.Reactions.Results {
+			counts[ReactionKey(rc.Reaction)] += rc.Count
+		}
+	}
+}
+
+const customEmojiPrefix = "custom:"
+
+// ReactionKey returns the string representation of the reaction: the
+// emoticon for emoji reactions, and "custom:<document id>" for the custom
+// emoji.  ParseReaction performs the reverse conversion.
+func ReactionKey(r tg.ReactionClass) string {
+	switch v := r.(type) {
+	case *tg.ReactionEmoji:
+		return v.Emoticon
+	case *tg.ReactionCustomEmoji:
+		return customEmojiPrefix + strconv.FormatInt(v.DocumentID, 10)
+	default:
+		return ""
+	}
+}
+
+// ParseReaction parses the string representation of the reaction, returned
+// by ReactionKey.
+func ParseReaction(s string) (tg.ReactionClass, error) {
+	if s == "" {
+		return nil, errors.New("empty reaction")
+	}
+	if !strings.HasPrefix(s, customEmojiPrefix) {
+		return &tg.ReactionEmoji{Emoticon: s}, nil
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(s, customEmojiPrefix), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid custom emoji reaction %q: %w", s, err)
+	}
+	return &tg.ReactionCustomEmoji{DocumentID: id}, nil
+}
@@ -0,0 +1,50 @@
+package mtpwrap
+
+import (
+	"testing"
+
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReaction(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    tg.ReactionClass
+		wantErr bool
+	}{
+		{"emoji", "👍", &tg.ReactionEmoji{Emoticon: "👍"}, false},
+		{"custom emoji", "custom:12345", &tg.ReactionCustomEmoji{DocumentID: 12345}, false},
+		{"invalid custom emoji", "custom:abc", nil, true},
+		{"empty", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReaction(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseReaction() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			if !tt.wantErr {
+				assert.Equal(t, tt.s, ReactionKey(got), "must round-trip")
+			}
+		})
+	}
+}
+
+func Test_addReactionCounts(t *testing.T) {
+	counts := map[string]int{"👍": 1}
+	addReactionCounts(counts, []tg.UpdateClass{
+		&tg.UpdateMessageReactions{MsgID: 1, Reactions: tg.MessageReactions{Results: []tg.ReactionCount{
+			{Reaction: &tg.ReactionEmoji{Emoticon: "👍"}, Count: 2},
+			{Reaction: &tg.ReactionCustomEmoji{DocumentID: 42}, Count: 1},
+		}}},
+		&tg.UpdateMessageReactions{MsgID: 2, Reactions: tg.MessageReactions{Results: []tg.ReactionCount{
+			{Reaction: &tg.ReactionEmoji{Emoticon: "👍"}, Count: 3},
+		}}},
+		&tg.UpdateNewMessage{},
+	})
+	assert.Equal(t, map[string]int{"👍": 6, "custom:42": 1}, counts)
+}
@@ -0,0 +1,186 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/trace"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+)
+
+// ResolveUsername returns the user or channel with the username, i.e.
+// "@durov".  It looks up the peer storage first, and if the username is not
+// there, resolves it with telegram, and stores the result.
+func (c *Client) ResolveUsername(ctx context.Context, username string) (Entity, error) {
+	ctx, task := trace.NewTask(ctx, "ResolveUsername")
+	defer task.End()
+
+	u := NormalizeUsername(username)
+	if u == "" {
+		return nil, errors.New("empty username")
+	}
+	if p, err := c.findLocal(ctx, func(idx PeerIndex) (storage.Peer, error) {
+		return idx.FindByUsername(ctx, u)
+	}, func(p storage.Peer) bool {
+		for _, pu := range peerUsernames(p) {
+			if pu == u {
+				return true
+			}
+		}
+		return false
+	}); err == nil {
+		if ent, ok := peerEntity(p); ok {
+			trace.Log(ctx, "storage", "hit")
+			return ent, nil
+		}
+	} else if !errors.Is(err, storage.ErrPeerNotFound) {
+		return nil, err
+	}
+	trace.Log(ctx, "storage", "miss")
+
+	resp, err := c.api().ContactsResolveUsername(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return c.storeResolved(ctx, resp)
+}
+
+// ResolvePhone returns the user with the phone number.  It looks up the peer
+// storage first, and if the phone is not there, resolves it with telegram, and
+// stores the result.
+func (c *Client) ResolvePhone(ctx context.Context, phone string) (Entity, error) {
+	ctx, task := trace.NewTask(ctx, "ResolvePhone")
+	defer task.End()
+
+	ph := normalizePhone(phone)
+	if ph == "" {
+		return nil, errors.New("empty phone")
+	}
+	if p, err := c.findLocal(ctx, func(idx PeerIndex) (storage.Peer, error) {
+		return idx.FindByPhone(ctx, ph)
+	}, func(p storage.Peer) bool {
+		return peerPhone(p) == ph
+	}); err == nil {
+		if ent, ok := peerEntity(p); ok {
+			return ent, nil
+		}
+	} else if !errors.Is(err, storage.ErrPeerNotFound) {
+		return nil, err
+	}
+
+	resp, err := c.api().ContactsResolvePhone(ctx, ph)
+	if err != nil {
+		return nil, err
+	}
+	return c.storeResolved(ctx, resp)
+}
+
+// FindByTitle returns the chats, channels and users, which title (or full
+// name for users) equals to the title, ignoring case and repeating
+// whitespace.  The storage is populated with dialogs, if necessary.  It
+// returns storage.ErrPeerNotFound, if there are no matches.
+func (c *Client) FindByTitle(ctx context.Context, title string) ([]Entity, error) {
+	ctx, task := trace.NewTask(ctx, "FindByTitle")
+	defer task.End()
+
+	if err := c.ensureStoragePopulated(ctx); err != nil {
+		return nil, err
+	}
+
+	t := NormalizeTitle(title)
+	var peers []storage.Peer
+	if idx, ok := c.peerStrg.(PeerIndex); ok {
+		var err error
+		if peers, err = idx.FindByTitle(ctx, t); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if peers, err = findPeers(ctx, c.peerStrg, func(p storage.Peer) bool {
+			return peerTitle(p) == t
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var ee []Entity
+	for _, p := range peers {
+		if ent, ok := peerEntity(p); ok {
+			ee = append(ee, ent)
+		}
+	}
+	if len(ee) == 0 {
+		return nil, storage.ErrPeerNotFound
+	}
+	return ee, nil
+}
+
+// findLocal finds the peer in the storage using the index, if the storage
+// supports it, or iterating over all peers, calling match for each of them.
+func (c *Client) findLocal(ctx context.Context, lookup func(PeerIndex) (storage.Peer, error), match func(storage.Peer) bool) (storage.Peer, error) {
+	if idx, ok := c.peerStrg.(PeerIndex); ok {
+		return lookup(idx)
+	}
+	peers, err := findPeers(ctx, c.peerStrg, match)
+	if err != nil {
+		return storage.Peer{}, err
+	}
+	if len(peers) == 0 {
+		return storage.Peer{}, storage.ErrPeerNotFound
+	}
+	return peers[0], nil
+}
+
+// findPeers returns all peers from the storage, that match.
+func findPeers(ctx context.Context, strg storage.PeerStorage, match func(storage.Peer) bool) ([]storage.Peer, error) {
+	it, err := strg.Iterate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var peers []storage.Peer
+	if err := storage.ForEach(ctx, it, func(p storage.Peer) error {
+		if match(p) {
+			peers = append(peers, p)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// storeResolved adds the users and chats from the resolved peer response to
+// the peer storage, and returns the resolved entity.
+func (c *Client) storeResolved(ctx context.Context, resp *tg.ContactsResolvedPeer) (Entity, error) {
+	if err := c.addPeers(ctx, resp.Users, resp.Chats); err != nil {
+		return nil, err
+	}
+	ent, ok := entityFor(resp.Peer, resp.Users, resp.Chats)
+	if !ok {
+		return nil, fmt.Errorf("resolved peer %v is not in the response", resp.Peer)
+	}
+	return ent, nil
+}
+
+// entityFor returns the entity of the peer from users and chats.
+func entityFor(p tg.PeerClass, users []tg.UserClass, chats []tg.ChatClass) (Entity, bool) {
+	switch p := p.(type) {
+	case *tg.PeerUser:
+		if u, ok := tg.UserClassArray(users).UserToMap()[p.UserID]; ok {
+			return UserEntity{u}, true
+		}
+	case *tg.PeerChat:
+		if ch, ok := tg.ChatClassArray(chats).ChatToMap()[p.ChatID]; ok {
+			return ch, true
+		}
+	case *tg.PeerChannel:
+		if ch, ok := tg.ChatClassArray(chats).ChannelToMap()[p.ChannelID]; ok {
+			return ch, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,88 @@
+package mtpwrap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_storeResolved(t *testing.T) {
+	var (
+		user    = &tg.User{ID: 1, AccessHash: 10, Username: "someuser"}
+		channel = &tg.Channel{ID: 2, AccessHash: 20, Title: "Channel", Username: "somechan"}
+	)
+	tests := []struct {
+		name    string
+		resp    *tg.ContactsResolvedPeer
+		want    Entity
+		wantErr bool
+	}{
+		{
+			"user",
+			&tg.ContactsResolvedPeer{Peer: &tg.PeerUser{UserID: 1}, Users: []tg.UserClass{user}, Chats: []tg.ChatClass{channel}},
+			UserEntity{user},
+			false,
+		},
+		{
+			"channel",
+			&tg.ContactsResolvedPeer{Peer: &tg.PeerChannel{ChannelID: 2}, Users: []tg.UserClass{user}, Chats: []tg.ChatClass{channel}},
+			channel,
+			false,
+		},
+		{
+			"missing",
+			&tg.ContactsResolvedPeer{Peer: &tg.PeerChannel{ChannelID: 3}, Chats: []tg.ChatClass{channel}},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := &Client{peerStrg: NewMemStorage()}
+			got, err := c.storeResolved(ctx, tt.resp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("storeResolved() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+
+			// all peers from the response are cached.
+			_, err = c.peerStrg.Find(ctx, storage.KeyFromPeer(mustPeer(t, channel)))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestClient_ResolveUsernameLocal(t *testing.T) {
+	ctx := context.Background()
+	channel := &tg.Channel{ID: 2, AccessHash: 20, Title: "Channel", Username: "somechan"}
+	for name, strg := range map[string]storage.PeerStorage{
+		"indexed":   NewMemStorage(),
+		"iteration": noIndex{NewMemStorage()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, strg.Add(ctx, mustPeer(t, channel)))
+			// api is not available, so the result must come from the storage.
+			c := &Client{peerStrg: strg}
+			got, err := c.ResolveUsername(ctx, "@SomeChan")
+			require.NoError(t, err)
+			assert.Equal(t, channel, got)
+		})
+	}
+}
+
+// noIndex hides the PeerIndex implementation of the storage.
+type noIndex struct {
+	storage.PeerStorage
+}
+
+func mustPeer(t *testing.T, chat tg.ChatClass) storage.Peer {
+	t.Helper()
+	var p storage.Peer
+	require.True(t, p.FromChat(chat))
+	return p
+}
@@ -0,0 +1,223 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"runtime/trace"
+	"slices"
+	"time"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+)
+
+// MediaType is the type of the message media.
+type MediaType string
+
+const (
+	MediaAny      MediaType = "any" // matches any media
+	MediaPhoto    MediaType = "photo"
+	MediaVideo    MediaType = "video"
+	MediaVoice    MediaType = "voice" // voice messages and round videos
+	MediaAudio    MediaType = "audio"
+	MediaSticker  MediaType = "sticker"
+	MediaGIF      MediaType = "gif"
+	MediaDocument MediaType = "document"
+	MediaWebPage  MediaType = "webpage"
+	MediaOther    MediaType = "other" // polls, locations, contacts, etc.
+)
+
+// Policy is the retention policy for own messages.
+type Policy struct {
+	// Name is used in logs.
+	Name string
+	// Dialogs selects the dialogs the policy applies to.
+	Dialogs FilterFunc
+	// Exclude is the list of dialog IDs, excluded from the policy.
+	Exclude []int64
+	// MaxAge is the maximum age of the message, older messages are deleted.
+	MaxAge time.Duration
+	// KeepPinned if set, pinned messages are not deleted.
+	KeepPinned bool
+	// KeepMedia is the list of media types, messages with which are not
+	// deleted.
+	KeepMedia []MediaType
+	// DryRun if set, messages are only logged, but not deleted.
+	DryRun bool
+}
+
+var errNoDialogs = errors.New("policy dialog selector is not set")
+
+func (p Policy) validate() error {
+	if p.Dialogs == nil {
+		return errNoDialogs
+	}
+	if p.MaxAge <= 0 {
+		return errors.New("policy max age must be positive")
+	}
+	return nil
+}
+
+// filter returns the dialog filter with exclusions applied.
+func (p Policy) filter() FilterFunc {
+	return func(peer storage.Peer) (Entity, bool) {
+		ent, ok := p.Dialogs(peer)
+		if !ok || slices.Contains(p.Exclude, ent.GetID()) {
+			return nil, false
+		}
+		return ent, true
+	}
+}
+
+// expired returns the messages, that must be deleted according to the policy
+// at the time now.
+func (p Policy) expired(msgs []messages.Elem, now time.Time) []messages.Elem {
+	cutoff := now.Add(-p.MaxAge)
+	var out []messages.Elem
+	for _, m := range msgs {
+		if !unixTime(m.Msg.GetDate()).Before(cutoff) {
+			continue
+		}
+		if p.keep(m.Msg) {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func (p Policy) keep(msg tg.NotEmptyMessage) bool {
+	m, ok := msg.(*tg.Message)
+	if !ok {
+		// service messages have no pins and media.
+		return false
+	}
+	if p.KeepPinned && m.Pinned {
+		return true
+	}
+	mt := mediaType(m.Media)
+	if mt == "" {
+		return false
+	}
+	return slices.Contains(p.KeepMedia, MediaAny) || slices.Contains(p.KeepMedia, mt)
+}
+
+// mediaType returns the type of the message media, or empty string, if there
+// is no media.
+func mediaType(media tg.MessageMediaClass) MediaType {
+	switch m := media.(type) {
+	case nil, *tg.MessageMediaEmpty:
+		return ""
+	case *tg.MessageMediaPhoto:
+		return MediaPhoto
+	case *tg.MessageMediaWebPage:
+		return MediaWebPage
+	case *tg.MessageMediaDocument:
+		doc, ok := m.Document.(*tg.Document)
+		if !ok {
+			return MediaDocument
+		}
+		mt := MediaDocument
+		for _, attr := range doc.Attributes {
+			switch a := attr.(type) {
+			case *tg.DocumentAttributeSticker:
+				return MediaSticker
+			case *tg.DocumentAttributeAnimated:
+				return MediaGIF
+			case *tg.DocumentAttributeAudio:
+				if a.Voice {
+					return MediaVoice
+				}
+				mt = MediaAudio
+			case *tg.DocumentAttributeVideo:
+				if a.RoundMessage {
+					return MediaVoice
+				}
+				mt = MediaVideo
+			}
+		}
+		return mt
+	default:
+		return MediaOther
+	}
+}
+
+// PolicyResult is the result of applying the policy.
+type PolicyResult struct {
+	Policy  string
+	Dialogs []PurgeResult
+	Err     error // error selecting the dialogs
+}
+
+// ApplyRetention applies the retention policies once, deleting the current
+// user messages, that have expired.  Every deletion is logged.
+func (c *Client) ApplyRetention(ctx context.Context, policies ...Policy) ([]PolicyResult, error) {
+	ctx, task := trace.NewTask(ctx, "ApplyRetention")
+	defer task.End()
+
+	for _, p := range policies {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var results = make([]PolicyResult, 0, len(policies))
+	for _, p := range policies {
+		res := PolicyResult{Policy: p.Name}
+		now := time.Now()
+		dlgs, err := c.GetEntities(ctx, p.filter())
+		if err != nil {
+			Log.Printf("retention %q: error listing dialogs: %s", p.Name, err)
+			res.Err = err
+			results = append(results, res)
+			continue
+		}
+		Log.Printf("retention %q: applying to %d dialogs, deleting messages older than %s", p.Name, len(dlgs), now.Add(-p.MaxAge).Format(time.RFC3339))
+		sel := func(msgs []messages.Elem) []messages.Elem {
+			return p.expired(msgs, now)
+		}
+		res.Dialogs = purge(ctx, dlgs, defPurgeConcurrency, func(ctx context.Context, dlg Entity) PurgeResult {
+			return c.purgeDialog(ctx, dlg, sel, p.DryRun, "retention "+p.Name)
+		})
+		results = append(results, res)
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// RunRetention applies the retention policies on schedule, until ctx is
+// cancelled or the client is stopped.  The client must be started with
+// Start.  Errors of the individual runs are logged, and don't stop the
+// schedule.
+func (c *Client) RunRetention(ctx context.Context, sched Schedule, policies ...Policy) error {
+	for _, p := range policies {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	done := c.Done()
+	for {
+		now := time.Now()
+		next := sched.Next(now)
+		if next.IsZero() {
+			return errors.New("schedule has no next run time")
+		}
+		Log.Printf("retention: next run at %s", next.Format(time.RFC3339))
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-done:
+			timer.Stop()
+			return ErrNotRunning
+		case <-timer.C:
+		}
+		if _, err := c.ApplyRetention(ctx, policies...); err != nil {
+			Log.Printf("retention: %s", err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package mtpwrap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_mediaType(t *testing.T) {
+	doc := func(attrs ...tg.DocumentAttributeClass) tg.MessageMediaClass {
+		return &tg.MessageMediaDocument{Document: &tg.Document{Attributes: attrs}}
+	}
+	tests := []struct {
+		name  string
+		media tg.MessageMediaClass
+		want  MediaType
+	}{
+		{"none", nil, ""},
+		{"empty", &tg.MessageMediaEmpty{}, ""},
+		{"photo", &tg.MessageMediaPhoto{}, MediaPhoto},
+		{"webpage", &tg.MessageMediaWebPage{}, MediaWebPage},
+		{"document", doc(&tg.DocumentAttributeFilename{FileName: "a.pdf"}), MediaDocument},
+		{"video", doc(&tg.DocumentAttributeVideo{}, &tg.DocumentAttributeFilename{}), MediaVideo},
+		{"round video", doc(&tg.DocumentAttributeVideo{RoundMessage: true}), MediaVoice},
+		{"gif", doc(&tg.DocumentAttributeVideo{}, &tg.DocumentAttributeAnimated{}), MediaGIF},
+		{"audio", doc(&tg.DocumentAttributeAudio{}), MediaAudio},
+		{"voice", doc(&tg.DocumentAttributeAudio{Voice: true}), MediaVoice},
+		{"sticker", doc(&tg.DocumentAttributeSticker{}), MediaSticker},
+		{"poll", &tg.MessageMediaPoll{}, MediaOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mediaType(tt.media))
+		})
+	}
+}
+
+func TestPolicy_expired(t *testing.T) {
+	var (
+		now = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+		old = int(now.AddDate(0, 0, -31).Unix())
+	)
+	msgs := []messages.Elem{
+		{Msg: &tg.Message{ID: 1, Date: old}},
+		{Msg: &tg.Message{ID: 2, Date: int(now.AddDate(0, 0, -1).Unix())}}, // recent
+		{Msg: &tg.Message{ID: 3, Date: old, Pinned: true}},
+		{Msg: &tg.Message{ID: 4, Date: old, Media: &tg.MessageMediaPhoto{}}},
+		{Msg: &tg.Message{ID: 5, Date: old, Media: &tg.MessageMediaPoll{}}},
+		{Msg: &tg.MessageService{ID: 6, Date: old}},
+	}
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []int
+	}{
+		{"age only", Policy{MaxAge: 30 * 24 * time.Hour}, []int{1, 3, 4, 5, 6}},
+		{"keep pinned", Policy{MaxAge: 30 * 24 * time.Hour, KeepPinned: true}, []int{1, 4, 5, 6}},
+		{"keep photos", Policy{MaxAge: 30 * 24 * time.Hour, KeepMedia: []MediaType{MediaPhoto}}, []int{1, 3, 5, 6}},
+		{"keep any media", Policy{MaxAge: 30 * 24 * time.Hour, KeepMedia: []MediaType{MediaAny}}, []int{1, 3, 6}},
+		{"nothing is old enough", Policy{MaxAge: 60 * 24 * time.Hour}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.expired(msgs, now)
+			var ids []int
+			if len(got) > 0 {
+				ids = messageIDs(got)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
+
+func TestPolicy_filter(t *testing.T) {
+	p := Policy{Dialogs: FilterChat(), Exclude: []int64{2}}
+	for _, tt := range []struct {
+		id   int64
+		want bool
+	}{{1, true}, {2, false}} {
+		var peer storage.Peer
+		require.True(t, peer.FromChat(&tg.Chat{ID: tt.id}))
+		_, ok := p.filter()(peer)
+		assert.Equal(t, tt.want, ok, "chat %d", tt.id)
+	}
+}
+
+func TestClient_RunRetention(t *testing.T) {
+	c := newTestClient(t)
+	p := Policy{Name: "test", Dialogs: FilterChat(), MaxAge: time.Hour}
+
+	// client is not running.
+	err := c.RunRetention(context.Background(), Every(time.Hour), p)
+	assert.ErrorIs(t, err, ErrNotRunning)
+
+	// invalid policy.
+	err = c.RunRetention(context.Background(), Every(time.Hour), Policy{MaxAge: time.Hour})
+	assert.ErrorIs(t, err, errNoDialogs)
+}
@@ -0,0 +1,172 @@
+package mtpwrap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule defines when the periodic job runs.
+type Schedule interface {
+	// Next returns the next run time after t.
+	Next(t time.Time) time.Time
+}
+
+// Every returns the schedule, that runs every d.
+func Every(d time.Duration) Schedule {
+	return interval(d)
+}
+
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// ParseSchedule parses the schedule specification.  It accepts:
+//
+//   - "@every <duration>", i.e. "@every 1h30m";
+//   - "@hourly", "@daily", "@weekly", "@monthly";
+//   - the standard 5-field cron expression "minute hour day-of-month month
+//     day-of-week", where each field is "*", a number, a range "a-b", a step
+//     "*/n" or "a-b/n", or a comma separated list of them.  Day of week is
+//     0-6, Sunday is 0.
+//
+// Times are evaluated in the local time zone.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		dur, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, err
+		}
+		if dur <= 0 {
+			return nil, fmt.Errorf("invalid interval: %s", dur)
+		}
+		return Every(dur), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	var (
+		cs     cronSchedule
+		bounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+		sets   = [5]*uint64{&cs.minute, &cs.hour, &cs.dom, &cs.month, &cs.dow}
+	)
+	for i, f := range fields {
+		set, err := parseCronField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: field %d: %w", spec, i+1, err)
+		}
+		*sets[i] = set
+	}
+	cs.anyDom = fields[2] == "*"
+	cs.anyDow = fields[4] == "*"
+	return cs, nil
+}
+
+// cronSchedule is the parsed cron expression, each field is a bit set.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	anyDom, anyDow                bool
+}
+
+// maxCronYears limits the search for the next run time, so that impossible
+// schedules, like "0 0 31 2 *", don't loop forever.
+const maxCronYears = 5
+
+func (cs cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxCronYears, 0, 0)
+	for t.Before(limit) {
+		if !has(cs.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !cs.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(cs.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(cs.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches follows the cron rule: if both day of month and day of week are
+// restricted, the day matches if either of them matches.
+func (cs cronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := has(cs.dom, t.Day()), has(cs.dow, int(t.Weekday()))
+	switch {
+	case cs.anyDom && cs.anyDow:
+		return true
+	case cs.anyDom:
+		return dow
+	case cs.anyDow:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+func has(set uint64, n int) bool {
+	return set&(1<<uint(n)) != 0
+}
+
+// parseCronField parses the cron field into the bit set.
+func parseCronField(f string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step: %q", stepStr)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return 0, fmt.Errorf("invalid value: %q", loStr)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return 0, fmt.Errorf("invalid value: %q", hiStr)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value out of range %d-%d: %q", min, max, part)
+		}
+		for i := lo; i <= hi; i += step {
+			set |= 1 << uint(i)
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,49 @@
+package mtpwrap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// Monday, 2024-01-01 10:20:30
+	var now = time.Date(2024, 1, 1, 10, 20, 30, 0, time.Local)
+	tests := []struct {
+		spec    string
+		want    time.Time
+		wantErr bool
+	}{
+		{"@every 90m", now.Add(90 * time.Minute), false},
+		{"@hourly", time.Date(2024, 1, 1, 11, 0, 0, 0, time.Local), false},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local), false},
+		{"@weekly", time.Date(2024, 1, 7, 0, 0, 0, 0, time.Local), false},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local), false},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 30, 0, 0, time.Local), false},
+		{"30 3 * * *", time.Date(2024, 1, 2, 3, 30, 0, 0, time.Local), false},
+		{"0 9-17/4 * * 1-5", time.Date(2024, 1, 1, 13, 0, 0, 0, time.Local), false},
+		{"0 0 * * 6,0", time.Date(2024, 1, 6, 0, 0, 0, 0, time.Local), false},
+		{"0 0 15 * 3", time.Date(2024, 1, 3, 0, 0, 0, 0, time.Local), false}, // dom or dow
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.Local), false},
+		{"0 0 31 2 *", time.Time{}, false}, // never
+		{"@every -1s", time.Time{}, true},
+		{"* * * *", time.Time{}, true},
+		{"60 * * * *", time.Time{}, true},
+		{"*/0 * * * *", time.Time{}, true},
+		{"5-1 * * * *", time.Time{}, true},
+		{"a * * * *", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, s.Next(now))
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+var (
+	// ErrNoPassword is returned, if the operation requires the 2FA password
+	// to be enabled.
+	ErrNoPassword = errors.New("2FA password is not enabled")
+	// ErrEmailUnconfirmed is returned by SetPassword and SetRecoveryEmail, if
+	// the recovery email must be confirmed with the code, sent to it.  See
+	// ConfirmRecoveryEmail.
+	ErrEmailUnconfirmed = errors.New("recovery email is not confirmed")
+)
+
+// PasswordSettings returns the 2FA password state of the account: whether
+// the password is set, its hint, and whether the recovery email is set.
+func (c *Client) PasswordSettings(ctx context.Context) (*tg.AccountPassword, error) {
+	return c.api().AccountGetPassword(ctx)
+}
+
+// SetPassword enables the 2FA password, or changes it, if it's already set.
+// current is the current password, it's ignored, if the password is not set.
+// email is the optional recovery email, if it is not empty, the function
+// returns ErrEmailUnconfirmed, and the password is enabled after the email
+// is confirmed with ConfirmRecoveryEmail.
+func (c *Client) SetPassword(ctx context.Context, current, newPassword, hint, email string) error {
+	if newPassword == "" {
+		return errors.New("new password is required")
+	}
+	p, err := c.api().AccountGetPassword(ctx)
+	if err != nil {
+		return err
+	}
+	check, err := checkPassword(p, current)
+	if err != nil {
+		return err
+	}
+	algo, ok := p.NewAlgo.(*tg.PasswordKdfAlgoSHA256SHA256PBKDF2HMACSHA512iter100000SHA256ModPow)
+	if !ok {
+		return fmt.Errorf("unsupported password algorithm: %T", p.NewAlgo)
+	}
+	hash, err := auth.NewPasswordHash([]byte(newPassword), algo)
+	if err != nil {
+		return err
+	}
+	settings := tg.AccountPasswordInputSettings{}
+	settings.SetNewAlgo(algo)
+	settings.SetNewPasswordHash(hash)
+	settings.SetHint(hint)
+	if email != "" {
+		settings.SetEmail(email)
+	}
+	return c.updatePasswordSettings(ctx, check, settings)
+}
+
+// DisablePassword removes the 2FA password and the recovery email.
+func (c *Client) DisablePassword(ctx context.Context, current string) error {
+	p, err := c.api().AccountGetPassword(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.HasPassword {
+		return ErrNoPassword
+	}
+	check, err := checkPassword(p, current)
+	if err != nil {
+		return err
+	}
+	settings := tg.AccountPasswordInputSettings{}
+	settings.SetNewAlgo(&tg.PasswordKdfAlgoUnknown{})
+	settings.SetNewPasswordHash([]byte{})
+	settings.SetHint("")
+	return c.updatePasswordSettings(ctx, check, settings)
+}
+
+// SetRecoveryEmail sets the recovery email of the 2FA password.  The email
+// must be confirmed with ConfirmRecoveryEmail, in which case
+// ErrEmailUnconfirmed is returned.
+func (c *Client) SetRecoveryEmail(ctx context.Context, current, email string) error {
+	p, err := c.api().AccountGetPassword(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.HasPassword {
+		return ErrNoPassword
+	}
+	check, err := checkPassword(p, current)
+	if err != nil {
+		return err
+	}
+	settings := tg.AccountPasswordInputSettings{}
+	settings.SetEmail(email)
+	return c.updatePasswordSettings(ctx, check, settings)
+}
+
+// ConfirmRecoveryEmail confirms the recovery email with the code, sent to
+// it.
+func (c *Client) ConfirmRecoveryEmail(ctx context.Context, code string) error {
+	_, err := c.api().AccountConfirmPasswordEmail(ctx, code)
+	return err
+}
+
+func (c *Client) updatePasswordSettings(ctx context.Context, check tg.InputCheckPasswordSRPClass, settings tg.AccountPasswordInputSettings) error {
+	_, err := c.api().AccountUpdatePasswordSettings(ctx, &tg.AccountUpdatePasswordSettingsRequest{
+		Password:    check,
+		NewSettings: settings,
+	})
+	if tgerr.Is(err, "EMAIL_UNCONFIRMED") {
+		return ErrEmailUnconfirmed
+	}
+	if tg.IsPasswordHashInvalid(err) {
+		return auth.ErrPasswordInvalid
+	}
+	return err
+}
+
+// checkPassword returns the SRP proof of the current password, or the empty
+// proof, if the password is not set.
+func checkPassword(p *tg.AccountPassword, current string) (tg.InputCheckPasswordSRPClass, error) {
+	if !p.HasPassword {
+		return &tg.InputCheckPasswordEmpty{}, nil
+	}
+	if current == "" {
+		return nil, auth.ErrPasswordNotProvided
+	}
+	return auth.PasswordHash([]byte(current), p.SRPID, p.SRPB, p.SecureRandom, p.CurrentAlgo)
+}
+
+// Sessions returns the active sessions (authorizations) of the account.  The
+// current session has the Current flag set.
+func (c *Client) Sessions(ctx context.Context) ([]tg.Authorization, error) {
+	resp, err := c.api().AccountGetAuthorizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Authorizations, nil
+}
+
+// TerminateSession terminates the session with the hash.
+func (c *Client) TerminateSession(ctx context.Context, hash int64) error {
+	_, err := c.api().AccountResetAuthorization(ctx, hash)
+	return err
+}
+
+// TerminateOtherSessions terminates all sessions, except the current one.
+func (c *Client) TerminateOtherSessions(ctx context.Context) error {
+	_, err := c.api().AuthResetAuthorizations(ctx)
+	return err
+}
+
+// SessionTTL returns the time, after which the inactive sessions are
+// terminated.
+func (c *Client) SessionTTL(ctx context.Context) (time.Duration, error) {
+	resp, err := c.api().AccountGetAuthorizations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.AuthorizationTTLDays) * day, nil
+}
+
+// SetSessionTTL sets the time, after which the inactive sessions are
+// terminated.  ttl is rounded up to whole days.
+func (c *Client) SetSessionTTL(ctx context.Context, ttl time.Duration) error {
+	days, err := ttlDays(ttl)
+	if err != nil {
+		return err
+	}
+	_, err = c.api().AccountSetAuthorizationTTL(ctx, days)
+	return err
+}
+
+const day = 24 * time.Hour
+
+// ttlDays returns the duration in days, rounded up.
+func ttlDays(d time.Duration) (int, error) {
+	if d <= 0 {
+		return 0, errors.New("session TTL must be positive")
+	}
+	return int((d + day - 1) / day), nil
+}
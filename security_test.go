@@ -0,0 +1,50 @@
+package mtpwrap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ttlDays(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       time.Duration
+		want    int
+		wantErr bool
+	}{
+		{"week", 7 * day, 7, false},
+		{"rounded up", 30*day + time.Hour, 31, false},
+		{"less than a day", time.Minute, 1, false},
+		{"zero", 0, 0, true},
+		{"negative", -day, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ttlDays(tt.d)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ttlDays() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_checkPassword(t *testing.T) {
+	t.Run("no password", func(t *testing.T) {
+		got, err := checkPassword(&tg.AccountPassword{}, "ignored")
+		assert.NoError(t, err)
+		assert.Equal(t, &tg.InputCheckPasswordEmpty{}, got)
+	})
+	t.Run("password not provided", func(t *testing.T) {
+		_, err := checkPassword(&tg.AccountPassword{HasPassword: true}, "")
+		assert.ErrorIs(t, err, auth.ErrPasswordNotProvided)
+	})
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		_, err := checkPassword(&tg.AccountPassword{HasPassword: true, CurrentAlgo: &tg.PasswordKdfAlgoUnknown{}}, "secret")
+		assert.Error(t, err)
+	})
+}
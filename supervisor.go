@@ -0,0 +1,253 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gotd/td/telegram"
+)
+
+const statusBufSz = 16
+
+// Status is the connection status of the client.
+type Status int
+
+const (
+	StatusStopped    Status = iota // client is not running
+	StatusConnecting               // client is connecting or reconnecting
+	StatusReady                    // client is connected and authorized
+	StatusDegraded                 // health check failed, client may not be operational
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusStopped:
+		return "stopped"
+	case StatusConnecting:
+		return "connecting"
+	case StatusReady:
+		return "ready"
+	case StatusDegraded:
+		return "degraded"
+	default:
+		return "unknown"
+	}
+}
+
+// StatusEvent is sent on every change of the client status.
+type StatusEvent struct {
+	Status Status
+	// Err is the error that caused the status change, if any.  If the
+	// session can't be re-authorized, it's ErrAuth.
+	Err error
+}
+
+// WithHealthCheck enables the connection supervision for the client, started
+// with Start.  The health of the connection is checked every interval, if
+// the connection is lost, the client reconnects with exponential backoff, and
+// if the session becomes invalid, the authentication flow is run again.
+func WithHealthCheck(interval time.Duration) Option {
+	return func(c *Client) {
+		c.healthInterval = interval
+	}
+}
+
+// WithStatusHandler sets the function, that is called on every status change
+// of the client.  It must not block.
+func WithStatusHandler(fn func(StatusEvent)) Option {
+	return func(c *Client) {
+		c.statusFn = fn
+	}
+}
+
+// Status returns the channel, that receives the status changes of the
+// client.  The channel is buffered, and if the reader can't keep up, the
+// events are dropped.
+func (c *Client) Status() <-chan StatusEvent {
+	return c.statusC
+}
+
+// setStatus updates the client status, and notifies the listeners if the
+// status has changed.
+func (c *Client) setStatus(s Status, err error) {
+	c.mu.Lock()
+	changed := c.status != s
+	c.status = s
+	c.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	ev := StatusEvent{Status: s, Err: err}
+	if c.statusFn != nil {
+		c.statusFn(ev)
+	}
+	select {
+	case c.statusC <- ev:
+	default:
+		Log.Debugf("status channel is full, dropping: %s", s)
+	}
+}
+
+// conn is the running connection of the telegram client.
+type conn struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the client Run returns
+	err    error         // Run error, valid after done is closed
+}
+
+// connect runs the telegram client in background and blocks until it's
+// connected, or ctx is cancelled.  It is similar to bg.Connect, but allows to
+// watch for the client termination.  The ctx is used only for connecting, the
+// client runs until stopped.
+func connect(ctx context.Context, cl *telegram.Client) (*conn, error) {
+	runCtx, cancel := context.WithCancel(context.Background())
+	cn := &conn{cancel: cancel, done: make(chan struct{})}
+
+	initDone := make(chan struct{})
+	go func() {
+		defer close(cn.done)
+		cn.err = runTelegram(runCtx, cl, func(ctx context.Context) error {
+			close(initDone)
+			<-ctx.Done()
+			return nil
+		})
+	}()
+
+	select {
+	case <-ctx.Done():
+		cn.stop()
+		return nil, ctx.Err()
+	case <-cn.done:
+		cancel()
+		return nil, cn.err
+	case <-initDone:
+	}
+	return cn, nil
+}
+
+// stop stops the client and waits until it terminates.  It is safe to call
+// it several times.
+func (cn *conn) stop() error {
+	cn.cancel()
+	<-cn.done
+	if errors.Is(cn.err, context.Canceled) {
+		return nil
+	}
+	return cn.err
+}
+
+// supervise monitors the connection cn, until stopC is closed.
+func (c *Client) supervise(cn *conn, stopC <-chan struct{}, doneC chan<- struct{}) {
+	defer close(doneC)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(c.healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cn.done:
+			Log.Debugf("connection lost: %s", cn.err)
+			c.mu.Lock()
+			c.stop = nil // nothing to stop, until reconnected.
+			c.mu.Unlock()
+			c.setStatus(StatusDegraded, cn.err)
+			var err error
+			cn, err = c.reconnect(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					c.setStatus(StatusStopped, err)
+					go c.Stop()
+				}
+				return
+			}
+			c.setStatus(StatusReady, nil)
+		case <-ticker.C:
+			if err := c.checkHealth(ctx); err != nil {
+				var ea *ErrAuth
+				if errors.As(err, &ea) {
+					Log.Printf("session is no longer valid: %s", err)
+					if err := cn.stop(); err != nil {
+						Log.Debugf("error stopping: %s", err)
+					}
+					c.setStatus(StatusStopped, err)
+					go c.Stop()
+					return
+				}
+				if ctx.Err() == nil {
+					Log.Debugf("health check failed: %s", err)
+					c.setStatus(StatusDegraded, err)
+				}
+				continue
+			}
+			c.setStatus(StatusReady, nil)
+		}
+	}
+}
+
+// reconnect creates a new telegram client and connects it, retrying with
+// exponential backoff until it succeeds or ctx is cancelled.
+func (c *Client) reconnect(ctx context.Context) (*conn, error) {
+	var cn *conn
+	op := func() error {
+		c.setStatus(StatusConnecting, nil)
+		cl := c.newTelegramClient()
+		var err error
+		cn, err = connect(ctx, cl)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.cl = cl
+		c.stop = cn.stop
+		c.mu.Unlock()
+
+		if err := c.authenticate(ctx); err != nil {
+			if err := cn.stop(); err != nil {
+				Log.Debugf("error stopping: %s", err)
+			}
+			return backoff.Permanent(err)
+		}
+		return nil
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0 // retry until cancelled
+	if err := backoff.RetryNotify(op, backoff.WithContext(b, ctx), func(err error, d time.Duration) {
+		Log.Printf("reconnect failed: %s, retrying in %s", err, d)
+		c.setStatus(StatusDegraded, err)
+	}); err != nil {
+		return nil, err
+	}
+	return cn, nil
+}
+
+// checkHealth checks that the connection is alive and the session is
+// authorized.  If the session is not authorized, it runs the authentication
+// flow, and returns ErrAuth if it fails.
+func (c *Client) checkHealth(ctx context.Context) error {
+	pingCtx, cancel := context.WithTimeout(ctx, c.healthInterval)
+	defer cancel()
+	st, err := c.Client().Auth().Status(pingCtx)
+	if err != nil {
+		return err
+	}
+	if st.Authorized {
+		return nil
+	}
+	Log.Print("session is not authorized, re-authenticating")
+	return c.authenticate(ctx)
+}
@@ -0,0 +1,359 @@
+package mtpwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_setStatus(t *testing.T) {
+	var (
+		errTest = errors.New("test")
+		got     []StatusEvent
+	)
+	c := &Client{
+		statusC:  make(chan StatusEvent, statusBufSz),
+		statusFn: func(ev StatusEvent) { got = append(got, ev) },
+	}
+	c.setStatus(StatusConnecting, nil)
+	c.setStatus(StatusReady, nil)
+	c.setStatus(StatusReady, nil) // no change, must not be reported
+	c.setStatus(StatusDegraded, errTest)
+	c.setStatus(StatusStopped, nil)
+
+	want := []StatusEvent{
+		{Status: StatusConnecting},
+		{Status: StatusReady},
+		{Status: StatusDegraded, Err: errTest},
+		{Status: StatusStopped},
+	}
+	assert.Equal(t, want, got)
+
+	close(c.statusC)
+	var fromChan []StatusEvent
+	for ev := range c.Status() {
+		fromChan = append(fromChan, ev)
+	}
+	assert.Equal(t, want, fromChan)
+}
+
+func TestClient_setStatus_full(t *testing.T) {
+	c := &Client{statusC: make(chan StatusEvent, 1)}
+	c.setStatus(StatusConnecting, nil)
+	c.setStatus(StatusReady, nil) // dropped, must not block
+	assert.Equal(t, StatusEvent{Status: StatusConnecting}, <-c.Status())
+}
+
+var (
+	errConnect = errors.New("connection refused")
+	errDropped = errors.New("connection reset")
+)
+
+// fakeNetwork replaces the telegram client run function with the fake, that
+// allows to drop the connection and fail the connection attempts.
+type fakeNetwork struct {
+	mu       sync.Mutex
+	connects int           // number of connection attempts
+	fail     int           // number of the next connection attempts to fail
+	drop     chan struct{} // closed to drop the current connection
+	running  atomic.Int32
+}
+
+func newFakeNetwork(t *testing.T) *fakeNetwork {
+	t.Helper()
+	n := &fakeNetwork{drop: make(chan struct{})}
+	oldRun := runTelegram
+	t.Cleanup(func() { runTelegram = oldRun })
+	runTelegram = n.run
+	return n
+}
+
+func (n *fakeNetwork) run(ctx context.Context, _ *telegram.Client, f func(context.Context) error) error {
+	n.mu.Lock()
+	n.connects++
+	if n.fail > 0 {
+		n.fail--
+		n.mu.Unlock()
+		return errConnect
+	}
+	drop := n.drop
+	n.mu.Unlock()
+
+	n.running.Add(1)
+	defer n.running.Add(-1)
+	fctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errC := make(chan error, 1)
+	go func() { errC <- f(fctx) }()
+	select {
+	case err := <-errC:
+		return err
+	case <-drop:
+		cancel()
+		<-errC
+		return errDropped
+	}
+}
+
+// dropConn drops the current connection, and fails the next fail connection
+// attempts.
+func (n *fakeNetwork) dropConn(fail int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.fail = fail
+	close(n.drop)
+	n.drop = make(chan struct{})
+}
+
+func (n *fakeNetwork) attempts() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.connects
+}
+
+// fakeAuthResult replaces the authentication function with the fake, that
+// returns the error, set with set.
+type fakeAuthResult struct {
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func newFakeAuth(t *testing.T) *fakeAuthResult {
+	t.Helper()
+	a := new(fakeAuthResult)
+	oldAuth := authIfNecessary
+	t.Cleanup(func() { authIfNecessary = oldAuth })
+	authIfNecessary = func(context.Context, *telegram.Client, auth.Flow) error {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.calls++
+		return a.err
+	}
+	return a
+}
+
+func (a *fakeAuthResult) set(err error) {
+	a.mu.Lock()
+	a.err = err
+	a.mu.Unlock()
+}
+
+func (a *fakeAuthResult) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls
+}
+
+// fakeHealth is the fake API, that answers the health check with the error,
+// set with set, or with the current user.
+type fakeHealth struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (h *fakeHealth) set(err error) {
+	h.mu.Lock()
+	h.err = err
+	h.mu.Unlock()
+}
+
+func (h *fakeHealth) api(_ context.Context, req bin.Encoder) (bin.Encoder, error) {
+	if _, ok := req.(*tg.UsersGetUsersRequest); !ok {
+		return nil, fmt.Errorf("unexpected request: %T", req)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil {
+		return nil, h.err
+	}
+	return &tg.UserClassVector{Elems: []tg.UserClass{&tg.User{ID: 1, Self: true}}}, nil
+}
+
+// waitStatus returns the statuses, received until the status want, and the
+// event with it.
+func waitStatus(t *testing.T, c *Client, want Status) ([]Status, StatusEvent) {
+	t.Helper()
+	var seen []Status
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-c.Status():
+			seen = append(seen, ev.Status)
+			if ev.Status == want {
+				return seen, ev
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s, seen: %v", want, seen)
+		}
+	}
+}
+
+// startSupervised starts the client with the supervisor, and waits until
+// it's ready.
+func startSupervised(t *testing.T, interval time.Duration, h *fakeHealth) *Client {
+	t.Helper()
+	if h == nil {
+		h = new(fakeHealth)
+	}
+	c := newFakeAPIClient(t, h.api, WithHealthCheck(interval))
+	require.NoError(t, c.Start(context.Background()))
+	t.Cleanup(func() { c.Stop() })
+	waitStatus(t, c, StatusReady)
+	return c
+}
+
+func TestClient_supervise_reconnect(t *testing.T) {
+	tests := []struct {
+		name         string
+		fail         int
+		wantAttempts int
+		wantStatuses []Status
+	}{
+		{
+			"immediate",
+			0,
+			2,
+			[]Status{StatusDegraded, StatusConnecting, StatusReady},
+		},
+		{
+			"with backoff",
+			1,
+			3,
+			[]Status{StatusDegraded, StatusConnecting, StatusDegraded, StatusConnecting, StatusReady},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newFakeNetwork(t)
+			a := newFakeAuth(t)
+			c := startSupervised(t, time.Hour, nil)
+			oldCl := c.Client()
+
+			n.dropConn(tt.fail)
+			got, _ := waitStatus(t, c, StatusReady)
+			assert.Equal(t, tt.wantStatuses, got)
+			assert.Equal(t, tt.wantAttempts, n.attempts())
+			assert.Equal(t, 2, a.count(), "must authenticate after reconnect")
+			assert.NotSame(t, oldCl, c.Client(), "must use the new telegram client")
+			assert.Equal(t, int32(1), n.running.Load())
+
+			require.NoError(t, c.Stop())
+			assert.Equal(t, int32(0), n.running.Load())
+		})
+	}
+}
+
+func TestClient_supervise_reconnectAuthError(t *testing.T) {
+	errTest := errors.New("session revoked")
+	n := newFakeNetwork(t)
+	a := newFakeAuth(t)
+	c := startSupervised(t, time.Hour, nil)
+
+	a.set(errTest)
+	n.dropConn(0)
+	_, ev := waitStatus(t, c, StatusStopped)
+	var ea *ErrAuth
+	assert.ErrorAs(t, ev.Err, &ea)
+	assert.ErrorIs(t, ev.Err, errTest)
+	assert.Equal(t, 2, n.attempts(), "auth error must not be retried")
+
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client is not stopped")
+	}
+	assert.Equal(t, int32(0), n.running.Load())
+}
+
+func TestClient_supervise_healthCheck(t *testing.T) {
+	errPing := errors.New("ping timeout")
+	newFakeNetwork(t)
+	newFakeAuth(t)
+	h := new(fakeHealth)
+	c := startSupervised(t, 10*time.Millisecond, h)
+
+	h.set(errPing)
+	_, ev := waitStatus(t, c, StatusDegraded)
+	assert.ErrorIs(t, ev.Err, errPing)
+
+	h.set(nil)
+	_, ev = waitStatus(t, c, StatusReady)
+	assert.NoError(t, ev.Err)
+	require.NoError(t, c.Stop())
+}
+
+func TestClient_supervise_unauthorized(t *testing.T) {
+	errUnauthorized := tgerr.New(401, "AUTH_KEY_UNREGISTERED")
+
+	t.Run("re-authenticated", func(t *testing.T) {
+		newFakeNetwork(t)
+		a := newFakeAuth(t)
+		h := new(fakeHealth)
+		c := startSupervised(t, 10*time.Millisecond, h)
+
+		h.set(errUnauthorized)
+		require.Eventually(t, func() bool { return a.count() > 1 }, 5*time.Second, 5*time.Millisecond)
+		h.set(nil)
+		select {
+		case ev := <-c.Status():
+			t.Fatalf("unexpected status change: %v", ev)
+		case <-time.After(50 * time.Millisecond):
+		}
+		require.NoError(t, c.Stop())
+	})
+	t.Run("re-authentication failed", func(t *testing.T) {
+		errTest := errors.New("no code")
+		n := newFakeNetwork(t)
+		a := newFakeAuth(t)
+		h := new(fakeHealth)
+		c := startSupervised(t, 10*time.Millisecond, h)
+
+		a.set(errTest)
+		h.set(errUnauthorized)
+		_, ev := waitStatus(t, c, StatusStopped)
+		var ea *ErrAuth
+		assert.ErrorAs(t, ev.Err, &ea)
+		assert.ErrorIs(t, ev.Err, errTest)
+		select {
+		case <-c.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("client is not stopped")
+		}
+		assert.Equal(t, int32(0), n.running.Load())
+	})
+}
+
+func TestClient_supervise_stopWhileReconnecting(t *testing.T) {
+	n := newFakeNetwork(t)
+	newFakeAuth(t)
+	c := startSupervised(t, time.Hour, nil)
+
+	n.dropConn(1000) // never reconnects
+	waitStatus(t, c, StatusConnecting)
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- c.Stop() }()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop blocked while reconnecting")
+	}
+	assert.True(t, isClosed(c.Done()))
+	assert.Equal(t, int32(0), n.running.Load())
+	_, ev := waitStatus(t, c, StatusStopped)
+	assert.NoError(t, ev.Err)
+}
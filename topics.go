@@ -0,0 +1,291 @@
+package mtpwrap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime/trace"
+
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/query"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+
+	"github.com/rusq/mtpwrap/archive"
+)
+
+// ErrNotForum is returned if the operation requires a forum supergroup.
+var ErrNotForum = errors.New("chat is not a forum")
+
+// asForum returns the input channel of the forum supergroup.
+func asForum(dlg Entity) (tg.InputChannelClass, error) {
+	ch, ok := dlg.(*tg.Channel)
+	if !ok || !ch.Forum {
+		return nil, ErrNotForum
+	}
+	return ch.AsInput(), nil
+}
+
+// ListTopics returns the forum topics of the supergroup dlg, which titles
+// match the query q.  Empty query returns all topics.  Pinned topics come
+// first.
+func (c *Client) ListTopics(ctx context.Context, dlg Entity, q string) ([]*tg.ForumTopic, error) {
+	ch, err := asForum(dlg)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		topics []*tg.ForumTopic
+		req    = &tg.ChannelsGetForumTopicsRequest{
+			Channel: ch,
+			Q:       q,
+			Limit:   defBatchSize,
+		}
+	)
+	for {
+		resp, err := c.api().ChannelsGetForumTopics(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		var last *tg.ForumTopic
+		for _, t := range resp.Topics {
+			if ft, ok := t.(*tg.ForumTopic); ok {
+				topics = append(topics, ft)
+				last = ft
+			}
+		}
+		if len(resp.Topics) < req.Limit || len(topics) >= resp.Count || last == nil {
+			break
+		}
+		req.OffsetTopic = last.ID
+		req.OffsetID = last.TopMessage
+		req.OffsetDate = topMessageDate(resp.Messages, last.TopMessage)
+	}
+	return topics, nil
+}
+
+// topMessageDate returns the date of the message with id, or 0, if it's not
+// in msgs.
+func topMessageDate(msgs []tg.MessageClass, id int) int {
+	for _, m := range msgs {
+		if msg, ok := m.AsNotEmpty(); ok && msg.GetID() == id {
+			return msg.GetDate()
+		}
+	}
+	return 0
+}
+
+// CreateTopic creates the topic in the forum supergroup dlg, and returns the
+// topic ID.  iconEmojiID is the ID of the custom emoji, used as the topic
+// icon, zero means the default icon.
+func (c *Client) CreateTopic(ctx context.Context, dlg Entity, title string, iconEmojiID int64) (int, error) {
+	ch, err := asForum(dlg)
+	if err != nil {
+		return 0, err
+	}
+	if title == "" {
+		return 0, errors.New("title is required")
+	}
+	randomID, err := newRandomID()
+	if err != nil {
+		return 0, err
+	}
+	upd, err := c.api().ChannelsCreateForumTopic(ctx, &tg.ChannelsCreateForumTopicRequest{
+		Channel:     ch,
+		Title:       title,
+		IconEmojiID: iconEmojiID,
+		RandomID:    randomID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return topicFromUpdates(upd)
+}
+
+// topicFromUpdates returns the ID of the created topic, which is the ID of
+// the topic creation service message.
+func topicFromUpdates(upd tg.UpdatesClass) (int, error) {
+	var uu []tg.UpdateClass
+	switch u := upd.(type) {
+	case *tg.Updates:
+		uu = u.Updates
+	case *tg.UpdatesCombined:
+		uu = u.Updates
+	default:
+		return 0, fmt.Errorf("unexpected updates type: %T", upd)
+	}
+	for _, u := range uu {
+		nm, ok := u.(*tg.UpdateNewChannelMessage)
+		if !ok {
+			continue
+		}
+		svc, ok := nm.Message.(*tg.MessageService)
+		if !ok {
+			continue
+		}
+		if _, ok := svc.Action.(*tg.MessageActionTopicCreate); ok {
+			return svc.ID, nil
+		}
+	}
+	return 0, errors.New("topic creation message not found in updates")
+}
+
+// EditTopic changes the title and the icon of the topic.  Empty title or
+// zero iconEmojiID leave the corresponding value unchanged.
+func (c *Client) EditTopic(ctx context.Context, dlg Entity, topicID int, title string, iconEmojiID int64) error {
+	return c.editTopic(ctx, dlg, &tg.ChannelsEditForumTopicRequest{
+		TopicID:     topicID,
+		Title:       title,
+		IconEmojiID: iconEmojiID,
+	})
+}
+
+// CloseTopic closes the topic, if closed is true, or reopens it.  Only
+// administrators can post in closed topics.
+func (c *Client) CloseTopic(ctx context.Context, dlg Entity, topicID int, closed bool) error {
+	req := &tg.ChannelsEditForumTopicRequest{TopicID: topicID}
+	req.SetClosed(closed)
+	return c.editTopic(ctx, dlg, req)
+}
+
+func (c *Client) editTopic(ctx context.Context, dlg Entity, req *tg.ChannelsEditForumTopicRequest) error {
+	ch, err := asForum(dlg)
+	if err != nil {
+		return err
+	}
+	req.Channel = ch
+	_, err = c.api().ChannelsEditForumTopic(ctx, req)
+	return err
+}
+
+// PinTopic pins the topic, if pinned is true, or unpins it.
+func (c *Client) PinTopic(ctx context.Context, dlg Entity, topicID int, pinned bool) error {
+	ch, err := asForum(dlg)
+	if err != nil {
+		return err
+	}
+	_, err = c.api().ChannelsUpdatePinnedForumTopic(ctx, &tg.ChannelsUpdatePinnedForumTopicRequest{
+		Channel: ch,
+		TopicID: topicID,
+		Pinned:  pinned,
+	})
+	return err
+}
+
+// DeleteTopic deletes the topic with all its messages.  It returns the number
+// of deleted messages.  The deleted messages are removed from the archive, if
+// it's set.
+func (c *Client) DeleteTopic(ctx context.Context, dlg Entity, topicID int) (int, error) {
+	ch, err := asForum(dlg)
+	if err != nil {
+		return 0, err
+	}
+	c.cache.Remove(cacheKey(dlg.GetID()))
+	n, err := affectedHistory(ctx, func(ctx context.Context) (*tg.MessagesAffectedHistory, error) {
+		return c.api().ChannelsDeleteTopicHistory(ctx, &tg.ChannelsDeleteTopicHistoryRequest{
+			Channel:  ch,
+			TopMsgID: topicID,
+		})
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, c.unarchiveHistory(dlg, func(m archive.Message) bool {
+		return m.ID == topicID || m.TopicID == topicID
+	})
+}
+
+// messageTopicID returns the ID of the forum topic of the message, or 0, if
+// it's not in a topic.  Messages of the General topic have no topic ID.
+func messageTopicID(m *tg.Message) int {
+	hdr, ok := m.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok || !hdr.ForumTopic {
+		return 0
+	}
+	if hdr.ReplyToTopID != 0 {
+		// reply to a message in the topic.
+		return hdr.ReplyToTopID
+	}
+	return hdr.ReplyToMsgID
+}
+
+// SearchTopicMessages finds all messages from the person `who` in the topic
+// of the forum supergroup `dlg`.  To delete them, pass the result to
+// DeleteMessages.  For each message received, the callback function will be
+// invoked, if not nil.
+func (c *Client) SearchTopicMessages(ctx context.Context, dlg Entity, topicID int, who tg.InputPeerClass, cb func(n int)) ([]messages.Elem, error) {
+	ctx, task := trace.NewTask(ctx, "SearchTopicMessages")
+	defer task.End()
+
+	if _, err := asForum(dlg); err != nil {
+		return nil, err
+	}
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return nil, err
+	}
+	bld := query.Messages(c.api()).
+		Search(ip).
+		BatchSize(defBatchSize).
+		FromID(who).
+		TopMsgID(topicID).
+		Filter(&tg.InputMessagesFilterEmpty{})
+	elems, err := collectMessages(ctx, bld.Iter(), cb)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.archiveMessages(dlg, elems); err != nil {
+		return nil, err
+	}
+	return elems, nil
+}
+
+// GetTopicHistory returns the whole message history of the topic of the
+// forum supergroup `dlg`, newest messages first.  For each message received,
+// the callback function will be invoked, if not nil.
+func (c *Client) GetTopicHistory(ctx context.Context, dlg Entity, topicID int, cb func(n int)) ([]messages.Elem, error) {
+	if _, err := asForum(dlg); err != nil {
+		return nil, err
+	}
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return nil, err
+	}
+	bld := query.Messages(c.api()).
+		GetReplies(ip).
+		MsgID(topicID).
+		BatchSize(defBatchSize)
+	elems, err := collectMessages(ctx, bld.Iter(), cb)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.archiveMessages(dlg, elems); err != nil {
+		return nil, err
+	}
+	return elems, nil
+}
+
+// SendTopicMessage sends the text message to the topic of the forum
+// supergroup `dlg`.
+func (c *Client) SendTopicMessage(ctx context.Context, dlg Entity, topicID int, text string) error {
+	if _, err := asForum(dlg); err != nil {
+		return err
+	}
+	ip, err := asInputPeer(dlg)
+	if err != nil {
+		return err
+	}
+	_, err = message.NewSender(c.api()).To(ip).Reply(topicID).Text(ctx, text)
+	return err
+}
+
+func newRandomID() (int64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(b[:])), nil
+}
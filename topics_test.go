@@ -0,0 +1,176 @@
+package mtpwrap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rusq/mtpwrap/archive"
+)
+
+func Test_asForum(t *testing.T) {
+	forum := &tg.Channel{ID: 1, AccessHash: 10, Megagroup: true, Forum: true}
+	forum.SetFlags()
+
+	ch, err := asForum(forum)
+	require.NoError(t, err)
+	assert.Equal(t, &tg.InputChannel{ChannelID: 1, AccessHash: 10}, ch)
+
+	for _, ent := range []Entity{&tg.Channel{ID: 2, Megagroup: true}, &tg.Chat{ID: 3}, UserEntity{&tg.User{ID: 4}}} {
+		_, err := asForum(ent)
+		assert.ErrorIs(t, err, ErrNotForum, "%T", ent)
+	}
+}
+
+func TestClient_topicsNotForum(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		c     = newTestClient(t)
+		group = &tg.Channel{ID: 1, Megagroup: true}
+	)
+	_, err := c.ListTopics(ctx, group, "")
+	assert.ErrorIs(t, err, ErrNotForum)
+	_, err = c.CreateTopic(ctx, group, "topic", 0)
+	assert.ErrorIs(t, err, ErrNotForum)
+	assert.ErrorIs(t, c.CloseTopic(ctx, group, 1, true), ErrNotForum)
+	assert.ErrorIs(t, c.PinTopic(ctx, group, 1, true), ErrNotForum)
+	_, err = c.SearchTopicMessages(ctx, group, 1, &tg.InputPeerSelf{}, nil)
+	assert.ErrorIs(t, err, ErrNotForum)
+	_, err = c.GetTopicHistory(ctx, group, 1, nil)
+	assert.ErrorIs(t, err, ErrNotForum)
+	assert.ErrorIs(t, c.SendTopicMessage(ctx, group, 1, "hi"), ErrNotForum)
+}
+
+func Test_topicFromUpdates(t *testing.T) {
+	tests := []struct {
+		name    string
+		upd     tg.UpdatesClass
+		want    int
+		wantErr bool
+	}{
+		{
+			"created",
+			&tg.Updates{Updates: []tg.UpdateClass{
+				&tg.UpdateMessageID{ID: 42},
+				&tg.UpdateNewChannelMessage{Message: &tg.MessageService{ID: 42, Action: &tg.MessageActionTopicCreate{Title: "t"}}},
+			}},
+			42,
+			false,
+		},
+		{
+			"no service message",
+			&tg.Updates{Updates: []tg.UpdateClass{
+				&tg.UpdateNewChannelMessage{Message: &tg.Message{ID: 1}},
+			}},
+			0,
+			true,
+		},
+		{
+			"unexpected type",
+			&tg.UpdatesTooLong{},
+			0,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := topicFromUpdates(tt.upd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("topicFromUpdates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_topMessageDate(t *testing.T) {
+	msgs := []tg.MessageClass{
+		&tg.MessageEmpty{ID: 1},
+		&tg.Message{ID: 2, Date: 200},
+		&tg.MessageService{ID: 3, Date: 300},
+	}
+	assert.Equal(t, 200, topMessageDate(msgs, 2))
+	assert.Equal(t, 300, topMessageDate(msgs, 3))
+	assert.Equal(t, 0, topMessageDate(msgs, 1))
+	assert.Equal(t, 0, topMessageDate(msgs, 4))
+}
+
+func Test_messageTopicID(t *testing.T) {
+	tests := []struct {
+		name    string
+		replyTo tg.MessageReplyHeaderClass
+		want    int
+	}{
+		{"general topic", nil, 0},
+		{"not a forum reply", &tg.MessageReplyHeader{ReplyToMsgID: 5}, 0},
+		{"topic message", &tg.MessageReplyHeader{ForumTopic: true, ReplyToMsgID: 5}, 5},
+		{"reply in topic", &tg.MessageReplyHeader{ForumTopic: true, ReplyToMsgID: 7, ReplyToTopID: 5}, 5},
+		{"story reply", &tg.MessageReplyStoryHeader{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, messageTopicID(&tg.Message{ReplyTo: tt.replyTo}))
+		})
+	}
+}
+
+func TestClient_DeleteTopicArchive(t *testing.T) {
+	a, err := archive.Open(t.TempDir())
+	require.NoError(t, err)
+	defer a.Close()
+
+	forum := &tg.Channel{ID: 5, Forum: true, Megagroup: true}
+	peer, err := archivePeer(forum)
+	require.NoError(t, err)
+	require.NoError(t, a.Store(
+		archive.Message{Peer: peer, ID: 1},             // general topic
+		archive.Message{Peer: peer, ID: 2, TopicID: 3}, // other topic
+		archive.Message{Peer: peer, ID: 4},             // topic creation message
+		archive.Message{Peer: peer, ID: 5, TopicID: 4},
+		archive.Message{Peer: peer, ID: 6, TopicID: 4},
+	))
+
+	c := newFakeAPIClient(t, func(_ context.Context, req bin.Encoder) (bin.Encoder, error) {
+		if _, ok := req.(*tg.ChannelsDeleteTopicHistoryRequest); !ok {
+			return nil, fmt.Errorf("unexpected request: %T", req)
+		}
+		return &tg.MessagesAffectedHistory{PtsCount: 3}, nil
+	}, WithArchive(a))
+	n, err := c.DeleteTopic(context.Background(), forum, 4)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	got, err := a.Search(archive.Query{Peer: peer})
+	require.NoError(t, err)
+	var ids []int
+	for _, m := range got {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []int{2, 1}, ids)
+}
+
+func TestFilterForum(t *testing.T) {
+	tests := []struct {
+		name string
+		chat tg.ChatClass
+		want bool
+	}{
+		{"forum", &tg.Channel{ID: 1, Megagroup: true, Forum: true}, true},
+		{"supergroup", &tg.Channel{ID: 2, Megagroup: true}, false},
+		{"chat", &tg.Chat{ID: 3}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var peer storage.Peer
+			require.True(t, peer.FromChat(tt.chat))
+			_, ok := FilterForum()(peer)
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+}